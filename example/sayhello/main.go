@@ -18,11 +18,20 @@ type Response struct {
 	Reply string `json:"reply"`
 }
 
+type UserRequest struct {
+	ID int `path:"id" validate:"required" comment:"User ID"`
+}
+
 func HelloFunc(ctx context.Context, req *Request, rsp *Response) error {
 	rsp.Reply = "Hello " + req.Name
 	return nil
 }
 
+func HelloUserFunc(ctx context.Context, req *UserRequest, rsp *Response) error {
+	rsp.Reply = fmt.Sprintf("Hello user %d", req.ID)
+	return nil
+}
+
 func Stream(ctx context.Context, req websocket.RecvStream, rsp websocket.SendStream) error {
 	ct := 0
 	for {
@@ -49,6 +58,10 @@ func main() {
 		Get("/api/hello", HelloFunc).
 		Put("/api/hello", HelloFunc)
 
+	// curl '127.0.0.1:9001/api/users/42'
+	users := gofunc.ApiGroup("User", "/api/users")
+	gofunc.GET(users, "/{id}", HelloUserFunc)
+
 	// websocket: 127.0.0.1:9001/api/hello-ws
 	gofunc.ApiGroup("OtherService").
 		Stream("/api/hello-ws", Stream)
@@ -58,6 +71,9 @@ func main() {
 		rc.Response.BodyWriter().Write([]byte("HELLO FAST HTTP"))
 	})
 
+	// curl '127.0.0.1:9001/v1/hello?name=bob'
+	gofunc.PathMapping(map[string]string{"/v1/*": "/api/*"})
+
 	gofunc.Use(middleware.Recover).Use(middleware.Validator)
 	gofunc.Serve()
 }
@@ -0,0 +1,59 @@
+package gofunc
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/ottstack/gofunc/internal/serve"
+	"github.com/ottstack/gofunc/pkg/websocket"
+)
+
+// GET registers fn without reflection, its signature is checked at compile time
+func GET[Req, Rsp any](r *Router, path string, fn func(context.Context, *Req, *Rsp) error, opts ...RouteOption) *Router {
+	r.register("GET", path, typed(fn), getFunctionName(fn), opts...)
+	return r
+}
+
+// POST registers fn without reflection, its signature is checked at compile time
+func POST[Req, Rsp any](r *Router, path string, fn func(context.Context, *Req, *Rsp) error, opts ...RouteOption) *Router {
+	r.register("POST", path, typed(fn), getFunctionName(fn), opts...)
+	return r
+}
+
+// PUT registers fn without reflection, its signature is checked at compile time
+func PUT[Req, Rsp any](r *Router, path string, fn func(context.Context, *Req, *Rsp) error, opts ...RouteOption) *Router {
+	r.register("PUT", path, typed(fn), getFunctionName(fn), opts...)
+	return r
+}
+
+// PATCH registers fn without reflection, its signature is checked at compile time
+func PATCH[Req, Rsp any](r *Router, path string, fn func(context.Context, *Req, *Rsp) error, opts ...RouteOption) *Router {
+	r.register("PATCH", path, typed(fn), getFunctionName(fn), opts...)
+	return r
+}
+
+// DELETE registers fn without reflection, its signature is checked at compile time
+func DELETE[Req, Rsp any](r *Router, path string, fn func(context.Context, *Req, *Rsp) error, opts ...RouteOption) *Router {
+	r.register("DELETE", path, typed(fn), getFunctionName(fn), opts...)
+	return r
+}
+
+// STREAM registers a websocket handler of typed messages, they are encoded with the codec
+// selected by the Accept header of the handshake and documented as schemas of the route
+func STREAM[In, Out any](r *Router, path string, fn func(context.Context, websocket.RecvOf[In], websocket.SendOf[Out]) error, opts ...RouteOption) *Router {
+	r.register("STREAM", path, serve.NewTypedStream(fn), getFunctionName(fn), opts...)
+	return r
+}
+
+func typed[Req, Rsp any](fn func(context.Context, *Req, *Rsp) error) *serve.Typed {
+	return &serve.Typed{
+		Call: func(ctx context.Context, req, rsp interface{}) error {
+			return fn(ctx, req.(*Req), rsp.(*Rsp))
+		},
+		New: func() (interface{}, interface{}) {
+			return new(Req), new(Rsp)
+		},
+		ReqType: reflect.TypeOf((*Req)(nil)).Elem(),
+		RspType: reflect.TypeOf((*Rsp)(nil)).Elem(),
+	}
+}
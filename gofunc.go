@@ -1,75 +1,208 @@
 package gofunc
 
 import (
+	"context"
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ottstack/gofunc/internal/serve"
 	"github.com/ottstack/gofunc/pkg/middleware"
 	"github.com/valyala/fasthttp"
 )
 
-var globalServer = serve.NewServer()
+// defaultServer backs the package level functions
+var defaultServer = newDefaultServer()
 
-func ApiGroup(name string) *Router {
-	return &Router{name: name}
+// newDefaultServer defers a configuration error to Serve so that routes can still be registered
+func newDefaultServer() *Server {
+	s, err := NewServer()
+	if err != nil {
+		s, _ = NewServer(serve.IgnoreEnv())
+		s.err = err
+	}
+	return s
+}
+
+// ApiGroup creates a group of routes of the default server, see Server.ApiGroup
+func ApiGroup(name string, prefix ...string) *Router {
+	return defaultServer.ApiGroup(name, prefix...)
 }
 
 type Router struct {
-	name string
+	server      *Server
+	name        string
+	prefix      string
+	middlewares []middleware.Middleware
+}
+
+// Group creates a sub-group under prefix, inheriting the name and middlewares of r
+func (r *Router) Group(prefix string) *Router {
+	return &Router{
+		server:      r.server,
+		name:        r.name,
+		prefix:      joinPath(r.prefix, prefix),
+		middlewares: append([]middleware.Middleware{}, r.middlewares...),
+	}
+}
+
+// Use adds a middleware applied only to routes of the group registered afterwards,
+// inside the middlewares added by gofunc.Use
+func (r *Router) Use(m middleware.Middleware) *Router {
+	r.middlewares = append(r.middlewares, m)
+	return r
+}
+
+// RouteOption customizes a single route
+type RouteOption = serve.RouteOption
+
+// Timeout sets the deadline of the handler context, streams have none without it
+func Timeout(d time.Duration) RouteOption {
+	return serve.WithTimeout(d)
+}
+
+// Status sets the status code of successful responses, e.g. 201 or 204.
+// Handlers may still change it per request with reqctx.SetStatus.
+func Status(code int) RouteOption {
+	return serve.WithStatus(code)
+}
+
+// Pooled reuses request and response structs of the route across calls.
+// Types holding slices or maps can implement Resetter to keep their capacity,
+// other types are zeroed. Handlers must not retain them after returning.
+func Pooled() RouteOption {
+	return serve.WithPool()
+}
+
+// NoCompression never compresses responses of the route, e.g. for already compressed content
+func NoCompression() RouteOption {
+	return serve.WithoutCompression()
+}
+
+// MaxBodySize answers 413 to requests of the route with a body larger than size bytes, e.g. for uploads
+func MaxBodySize(size int) RouteOption {
+	return serve.WithMaxBodySize(size)
+}
+
+// File is an uploaded file of a multipart/form-data request, bound into request fields
+// of type *File or []*File by their json name. Large files are spilled to temporary files
+// removed once the handler returns.
+type File = serve.File
+
+// Download is a response type streaming a body, e.g. an export or a file, with
+// Content-Disposition and range requests supported for readers implementing io.Seeker
+type Download = serve.Download
+
+// Heartbeat sets the interval of comments keeping an idle event stream open through proxies,
+// 15s by default, zero disables them
+func Heartbeat(d time.Duration) RouteOption {
+	return serve.WithHeartbeat(d)
 }
 
-func (r *Router) Get(path string, function interface{}) *Router {
-	r.handle("GET", path, function)
+// Resetter is called instead of zeroing before a pooled struct is reused
+type Resetter = serve.Resetter
+
+func (r *Router) Get(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("GET", path, function, opts...)
+	return r
+}
+func (r *Router) Post(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("POST", path, function, opts...)
+	return r
+}
+func (r *Router) Delete(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("DELETE", path, function, opts...)
 	return r
 }
-func (r *Router) Post(path string, function interface{}) *Router {
-	r.handle("POST", path, function)
+func (r *Router) Put(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("PUT", path, function, opts...)
 	return r
 }
-func (r *Router) Delete(path string, function interface{}) *Router {
-	r.handle("DELETE", path, function)
+func (r *Router) Patch(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("PATCH", path, function, opts...)
 	return r
 }
-func (r *Router) Put(path string, function interface{}) *Router {
-	r.handle("PUT", path, function)
+func (r *Router) Stream(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("STREAM", path, function, opts...)
 	return r
 }
-func (r *Router) Stream(path string, function interface{}) *Router {
-	r.handle("STREAM", path, function)
+
+// Events serves Server-Sent Events on GET path, function is like
+// func(ctx context.Context, req *Request, rsp sse.SendStream) error.
+// It runs after the middlewares once the stream is open, so a returned error is sent as an "error" event.
+func (r *Router) Events(path string, function interface{}, opts ...RouteOption) *Router {
+	r.handle("EVENTS", path, function, opts...)
 	return r
 }
 
-func (r *Router) handle(method, path string, function interface{}) {
-	name := getFunctionName(function)
+func (r *Router) handle(method, path string, function interface{}, opts ...RouteOption) {
+	r.register(method, path, function, getFunctionName(function), opts...)
+}
+
+func (r *Router) register(method, path string, function interface{}, name string, opts ...RouteOption) {
 	if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
 		name = name[idx+1:]
 	}
-	err := globalServer.Handle(method, path, function, name, r.name)
+	if len(r.middlewares) > 0 {
+		opts = append([]RouteOption{serve.WithMiddlewares(r.middlewares...)}, opts...)
+	}
+	err := r.server.server.Handle(method, joinPath(r.prefix, path), function, name, r.name, opts...)
 	if err != nil {
 		panic(err)
 	}
 }
 
+func joinPath(prefix string, paths ...string) string {
+	for _, p := range paths {
+		slash := strings.HasSuffix(p, "/")
+		p = strings.Trim(p, "/")
+		if p == "" {
+			continue
+		}
+		prefix = strings.TrimRight(prefix, "/") + "/" + p
+		if slash {
+			prefix += "/"
+		}
+	}
+	return prefix
+}
+
 func getFunctionName(i interface{}) string {
 	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 }
 
-func Use(m middleware.Middleware) *serve.Server {
-	return globalServer.Use(m)
+func Use(m middleware.Middleware) *Server {
+	return defaultServer.Use(m)
+}
+
+// UseHTTP adds a middleware to every request of the default server, see Server.UseHTTP
+func UseHTTP(m middleware.Middleware) *Server {
+	return defaultServer.UseHTTP(m)
 }
 
 func HandleHTTP(method, path string, f func(*fasthttp.RequestCtx)) {
-	err := globalServer.Handle(method, path, f, "", "")
-	if err != nil {
-		panic(err)
-	}
+	defaultServer.HandleHTTP(method, path, f)
 }
 
-// Serve ...
+// PathMapping sets the path mapping of the default server, see Server.PathMapping
+func PathMapping(m map[string]string) {
+	defaultServer.PathMapping(m)
+}
+
+// RegisterCodec adds a codec to the default server, see Server.RegisterCodec
+func RegisterCodec(mediaType string, c Codec) {
+	defaultServer.RegisterCodec(mediaType, c)
+}
+
+// Serve serves the default server until SIGTERM/SIGINT or Shutdown
 func Serve() {
-	if err := globalServer.Serve(); err != nil {
+	if err := defaultServer.Serve(); err != nil {
 		panic(err)
 	}
 }
+
+// Shutdown gracefully stops the default server, waiting for in-flight requests and streams until ctx is done
+func Shutdown(ctx context.Context) error {
+	return defaultServer.Shutdown(ctx)
+}
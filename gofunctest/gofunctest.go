@@ -0,0 +1,306 @@
+// Package gofunctest serves gofunc servers in memory for tests.
+package gofunctest
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	json "github.com/goccy/go-json"
+	"github.com/gorilla/schema"
+	"github.com/ottstack/gofunc"
+	"github.com/ottstack/gofunc/pkg/ecode"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+const baseURL = "http://gofunctest"
+
+// Client sends requests to a server listening in memory
+type Client struct {
+	ln     *fasthttputil.InmemoryListener
+	client *fasthttp.Client
+}
+
+// NewServer serves s on an in-memory listener and shuts it down when t finishes
+func NewServer(t testing.TB, s *gofunc.Server) *Client {
+	t.Helper()
+	ln := fasthttputil.NewInmemoryListener()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ServeListener(ln)
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+		if err := <-errCh; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	})
+	return &Client{
+		ln: ln,
+		client: &fasthttp.Client{Dial: func(addr string) (net.Conn, error) {
+			return ln.Dial()
+		}},
+	}
+}
+
+// RequestOption customizes a request sent by Do, e.g. with headers or cookies
+type RequestOption func(*fasthttp.Request)
+
+// Header sets a request header
+func Header(key, value string) RequestOption {
+	return func(r *fasthttp.Request) {
+		r.Header.Set(key, value)
+	}
+}
+
+// Cookie sets a request cookie
+func Cookie(key, value string) RequestOption {
+	return func(r *fasthttp.Request) {
+		r.Header.SetCookie(key, value)
+	}
+}
+
+// DoHTTP sends a raw request, e.g. to check status codes and headers.
+// Relative request URIs are sent to the server of c.
+func (c *Client) DoHTTP(fastReq *fasthttp.Request, fastRsp *fasthttp.Response) error {
+	if len(fastReq.Host()) == 0 {
+		fastReq.SetRequestURI(baseURL + string(fastReq.RequestURI()))
+	}
+	return c.client.Do(fastReq, fastRsp)
+}
+
+// Send sends a request with a raw body and returns the response whatever its status,
+// e.g. to check status codes and headers. It fails t if the request cannot be sent.
+func (c *Client) Send(t testing.TB, method, path string, body []byte, opts ...RequestOption) *fasthttp.Response {
+	t.Helper()
+	fastReq := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(fastReq)
+	fastRsp := &fasthttp.Response{}
+	fastReq.Header.SetMethod(strings.ToUpper(method))
+	fastReq.SetRequestURI(baseURL + path)
+	fastReq.SetBody(body)
+	for _, opt := range opts {
+		opt(fastReq)
+	}
+	if err := c.client.Do(fastReq, fastRsp); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return fastRsp
+}
+
+// Do sends req and decodes a successful response into rsp.
+// req is encoded as query for GET, HEAD and DELETE and as JSON body otherwise,
+// except fields tagged with query, header or cookie which are sent there, and path ones
+// which are left to path. A failed response is returned as *ecode.APIError.
+func (c *Client) Do(method, path string, req, rsp interface{}, opts ...RequestOption) error {
+	fastReq := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(fastReq)
+	fastRsp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(fastRsp)
+
+	method = strings.ToUpper(method)
+	fastReq.Header.SetMethod(method)
+	uri := baseURL + path
+	if req != nil {
+		values, boundQuery := url.Values{}, url.Values{}
+		bound := setBound(reflect.ValueOf(req), fastReq, boundQuery)
+		switch method {
+		case "GET", "HEAD", "DELETE":
+			enc := schema.NewEncoder()
+			enc.SetAliasTag("json")
+			if err := enc.Encode(req, values); err != nil {
+				return err
+			}
+			for _, name := range bound {
+				values.Del(name)
+			}
+		default:
+			bs, err := marshalBody(req, bound)
+			if err != nil {
+				return err
+			}
+			fastReq.Header.SetContentType("application/json")
+			fastReq.SetBody(bs)
+		}
+		for name, vs := range boundQuery {
+			values[name] = append(values[name], vs...)
+		}
+		if len(values) > 0 {
+			sep := "?"
+			if strings.Contains(uri, "?") {
+				sep = "&"
+			}
+			uri += sep + values.Encode()
+		}
+	}
+	fastReq.SetRequestURI(uri)
+	for _, opt := range opts {
+		opt(fastReq)
+	}
+	if err := c.client.Do(fastReq, fastRsp); err != nil {
+		return err
+	}
+
+	code := fastRsp.StatusCode()
+	if code < 200 || code >= 300 {
+		apiErr := &ecode.APIError{}
+		if err := json.Unmarshal(fastRsp.Body(), apiErr); err != nil || apiErr.Code == 0 {
+			return &ecode.APIError{Code: code, Message: string(fastRsp.Body())}
+		}
+		return apiErr
+	}
+	if rsp == nil || len(fastRsp.Body()) == 0 {
+		return nil
+	}
+	return json.Unmarshal(fastRsp.Body(), rsp)
+}
+
+// setBound sets the query, header and cookie fields of the struct v on query and fastReq,
+// it returns the json names of the fields with a declared source
+func setBound(v reflect.Value, fastReq *fasthttp.Request, query url.Values) []string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var bound []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous {
+			bound = append(bound, setBound(v.Field(i), fastReq, query)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		isBound := false
+		for _, tag := range []string{"path", "query", "header", "cookie"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			isBound = true
+			for _, value := range formatValues(v.Field(i)) {
+				switch tag {
+				case "query":
+					query.Add(name, value)
+				case "header":
+					fastReq.Header.Add(name, value)
+				case "cookie":
+					fastReq.Header.SetCookie(name, value)
+				}
+			}
+		}
+		if isBound {
+			bound = append(bound, jsonName(field))
+		}
+	}
+	return bound
+}
+
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// formatValues formats a non-zero field value, one value per element of slices
+func formatValues(v reflect.Value) []string {
+	if v.IsZero() {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		var ret []string
+		for i := 0; i < v.Len(); i++ {
+			ret = append(ret, formatValues(v.Index(i))...)
+		}
+		return ret
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return []string{string(text)}
+		}
+	}
+	return []string{fmt.Sprint(v.Interface())}
+}
+
+// marshalBody encodes req as JSON without the fields named bound
+func marshalBody(req interface{}, bound []string) ([]byte, error) {
+	bs, err := json.Marshal(req)
+	if err != nil || len(bound) == 0 {
+		return bs, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(bs, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range bound {
+		delete(fields, name)
+	}
+	return json.Marshal(fields)
+}
+
+// Call is Do failing t on any error
+func (c *Client) Call(t testing.TB, method, path string, req, rsp interface{}, opts ...RequestOption) {
+	t.Helper()
+	if err := c.Do(method, path, req, rsp, opts...); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+}
+
+// CallError sends a request expected to fail with an APIError of code
+func (c *Client) CallError(t testing.TB, method, path string, req interface{}, code int, opts ...RequestOption) *ecode.APIError {
+	t.Helper()
+	return AssertAPIError(t, c.Do(method, path, req, nil, opts...), code)
+}
+
+// AssertAPIError fails t unless err is an *ecode.APIError with code
+func AssertAPIError(t testing.TB, err error, code int) *ecode.APIError {
+	t.Helper()
+	var apiErr *ecode.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expect APIError with code %d, got %v", code, err)
+		return nil
+	}
+	if apiErr.Code != code {
+		t.Fatalf("expect APIError with code %d, got %d: %s", code, apiErr.Code, apiErr.Message)
+	}
+	return apiErr
+}
+
+// DialStream opens a websocket to a Stream route, the connection is closed when t finishes
+func (c *Client) DialStream(t testing.TB, path string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		return c.ln.Dial()
+	}}
+	conn, _, err := dialer.Dial(strings.Replace(baseURL, "http", "ws", 1)+path, nil)
+	if err != nil {
+		t.Fatalf("dial stream %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
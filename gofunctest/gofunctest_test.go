@@ -0,0 +1,493 @@
+package gofunctest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/ottstack/gofunc"
+	"github.com/ottstack/gofunc/pkg/ecode"
+	"github.com/ottstack/gofunc/pkg/middleware"
+	"github.com/ottstack/gofunc/pkg/reqctx"
+	"github.com/ottstack/gofunc/pkg/sse"
+	gows "github.com/ottstack/gofunc/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type helloRequest struct {
+	ID     int      `json:"id" path:"id"`
+	Name   string   `json:"name" validate:"required"`
+	DryRun bool     `query:"dryRun"`
+	Tags   []string `query:"tag"`
+}
+
+type helloResponse struct {
+	Reply  string   `json:"reply"`
+	ID     int      `json:"id"`
+	DryRun bool     `json:"dryRun"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+func hello(ctx context.Context, req *helloRequest, rsp *helloResponse) error {
+	rsp.Reply = "Hello " + req.Name
+	rsp.ID = req.ID
+	rsp.DryRun = req.DryRun
+	rsp.Tags = req.Tags
+	return nil
+}
+
+type tenantRequest struct {
+	Tenant  string `header:"X-Tenant" validate:"required"`
+	Session string `cookie:"session"`
+}
+
+type tenantResponse struct {
+	Tenant  string `json:"tenant"`
+	Session string `json:"session"`
+}
+
+func tenant(ctx context.Context, req *tenantRequest, rsp *tenantResponse) error {
+	rsp.Tenant = req.Tenant
+	rsp.Session = req.Session
+	return nil
+}
+
+type uploadRequest struct {
+	Title string         `json:"title" validate:"required"`
+	File  *gofunc.File   `json:"file" validate:"required"`
+	Extra []*gofunc.File `json:"extra"`
+}
+
+type uploadResponse struct {
+	Title   string   `json:"title"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Extra   []string `json:"extra"`
+}
+
+func upload(ctx context.Context, req *uploadRequest, rsp *uploadResponse) error {
+	f, err := req.File.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	rsp.Title = req.Title
+	rsp.Name = req.File.Name
+	rsp.Content = string(content)
+	for _, extra := range req.Extra {
+		rsp.Extra = append(rsp.Extra, extra.Name)
+	}
+	return nil
+}
+
+type exportRequest struct {
+	Name string `json:"name"`
+}
+
+func export(ctx context.Context, req *exportRequest, rsp *gofunc.Download) error {
+	rsp.Reader = strings.NewReader("0123456789")
+	rsp.ContentType = "text/plain"
+	rsp.Name = req.Name
+	return nil
+}
+
+// exportLatest redirects to the current export, answering without body
+func exportLatest(ctx context.Context, req *exportRequest, rsp *gofunc.Download) error {
+	reqctx.Redirect(ctx, "/api/export?name=digits.txt", 302)
+	return nil
+}
+
+type ticksRequest struct {
+	Count int `json:"count" validate:"required"`
+}
+
+func ticks(ctx context.Context, req *ticksRequest, rsp sse.SendStream) error {
+	start, _ := strconv.Atoi(rsp.LastEventID())
+	for i := start + 1; i <= req.Count; i++ {
+		if err := rsp.SendEvent(sse.Event{ID: strconv.Itoa(i), Event: "tick", Data: []byte("a\nb")}); err != nil {
+			return err
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	return ecode.Errorf(4001, "no more ticks")
+}
+
+type chatIn struct {
+	Text string `json:"text" validate:"required"`
+}
+
+type chatOut struct {
+	Reply string `json:"reply"`
+}
+
+func chat(ctx context.Context, req gows.RecvOf[chatIn], rsp gows.SendOf[chatOut]) error {
+	for {
+		msg, err := req.Recv()
+		if apiErr, ok := err.(*ecode.APIError); ok {
+			if err := rsp.Send(&chatOut{Reply: apiErr.Message}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := rsp.Send(&chatOut{Reply: "re: " + msg.Text}); err != nil {
+			return err
+		}
+	}
+}
+
+func echo(ctx context.Context, req gows.RecvStream, rsp gows.SendStream) error {
+	for {
+		msg, err := req.Recv()
+		if err != nil {
+			return err
+		}
+		if err := rsp.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// newTestClient serves a server with the Recover and Validator middlewares,
+// setup registers the routes of a test in the group under /api
+func newTestClient(t *testing.T, setup func(s *gofunc.Server, g *gofunc.Router), opts ...gofunc.ServerOption) *Client {
+	t.Helper()
+	s, err := gofunc.NewServer(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Use(middleware.Recover).Use(middleware.Validator)
+	setup(s, s.ApiGroup("Test", "/api"))
+	return NewServer(t, s)
+}
+
+func helloRoutes(s *gofunc.Server, g *gofunc.Router) {
+	gofunc.GET(g, "/hello/{id}", hello)
+	gofunc.POST(g, "/hello/{id}", hello)
+}
+
+func TestCall(t *testing.T) {
+	c := newTestClient(t, helloRoutes)
+
+	rsp := &helloResponse{}
+	c.Call(t, "GET", "/api/hello/1", &helloRequest{Name: "bob"}, rsp)
+	assert.Equal(t, "Hello bob", rsp.Reply)
+	assert.Equal(t, 1, rsp.ID)
+
+	rsp = &helloResponse{}
+	c.Call(t, "POST", "/api/hello/2", &helloRequest{Name: "tom"}, rsp)
+	assert.Equal(t, "Hello tom", rsp.Reply)
+	assert.Equal(t, 2, rsp.ID)
+
+	c.CallError(t, "GET", "/api/hello/1", &helloRequest{}, 400)
+	c.CallError(t, "GET", "/api/missing", nil, 404)
+	c.CallError(t, "DELETE", "/api/hello/1", nil, 405)
+}
+
+func TestDialStream(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		g.Stream("/echo", echo)
+	})
+
+	conn := c.DialStream(t, "/api/echo")
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+	_, msg, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(msg))
+}
+
+func TestTypedStream(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		gofunc.STREAM(g, "/chat", chat)
+	})
+
+	conn := c.DialStream(t, "/api/chat")
+	assert.Nil(t, conn.WriteJSON(&chatIn{Text: "hi"}))
+	rsp := &chatOut{}
+	assert.Nil(t, conn.ReadJSON(rsp))
+	assert.Equal(t, "re: hi", rsp.Reply)
+
+	assert.Nil(t, conn.WriteJSON(&chatIn{}))
+	assert.Nil(t, conn.ReadJSON(rsp))
+	assert.Contains(t, rsp.Reply, "required")
+}
+
+func TestHeaderCookieBinding(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		gofunc.GET(g, "/tenant", tenant)
+	})
+	c.CallError(t, "GET", "/api/tenant", nil, 400)
+
+	rsp := &tenantResponse{}
+	c.Call(t, "GET", "/api/tenant", nil, rsp, Header("X-Tenant", "acme"), Cookie("session", "s1"))
+	assert.Equal(t, &tenantResponse{Tenant: "acme", Session: "s1"}, rsp)
+
+	// header and cookie fields of the request are sent as such
+	rsp = &tenantResponse{}
+	c.Call(t, "GET", "/api/tenant", &tenantRequest{Tenant: "acme", Session: "s1"}, rsp)
+	assert.Equal(t, &tenantResponse{Tenant: "acme", Session: "s1"}, rsp)
+
+	fastReq := &fasthttp.Request{}
+	fastRsp := &fasthttp.Response{}
+	fastReq.SetRequestURI("/api/tenant")
+	fastReq.Header.Set("X-Tenant", "acme")
+	assert.Nil(t, c.DoHTTP(fastReq, fastRsp))
+	assert.Equal(t, 200, fastRsp.StatusCode())
+	assert.Equal(t, "application/json", string(fastRsp.Header.ContentType()))
+
+	// a header field is never set from the query string
+	c.CallError(t, "GET", "/api/tenant?Tenant=acme", nil, 400)
+}
+
+func TestMergedBinding(t *testing.T) {
+	c := newTestClient(t, helloRoutes)
+	rsp := &helloResponse{}
+	c.Call(t, "POST", "/api/hello/7?dryRun=true&tag=a&tag=b", &helloRequest{Name: "bob", ID: 1}, rsp)
+	assert.Equal(t, &helloResponse{Reply: "Hello bob", ID: 7, DryRun: true, Tags: []string{"a", "b"}}, rsp)
+
+	c.CallError(t, "POST", "/api/hello/7?dryRun=maybe", &helloRequest{Name: "bob"}, 400)
+
+	// query fields of the request are sent under their query names
+	for _, method := range []string{"GET", "POST"} {
+		rsp = &helloResponse{}
+		c.Call(t, method, "/api/hello/7", &helloRequest{Name: "bob", DryRun: true, Tags: []string{"a", "b"}}, rsp)
+		assert.Equal(t, &helloResponse{Reply: "Hello bob", ID: 7, DryRun: true, Tags: []string{"a", "b"}}, rsp, method)
+	}
+
+	// and are left out of the body
+	req := &helloRequest{Name: "bob", ID: 1, DryRun: true}
+	body, err := marshalBody(req, setBound(reflect.ValueOf(req), &fasthttp.Request{}, url.Values{}))
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"name":"bob"}`, string(body))
+
+	// fields with a declared source are never set from the body or by their field name in the query
+	rsp = &helloResponse{}
+	c.Call(t, "POST", "/api/hello/7", map[string]interface{}{"name": "bob", "DryRun": true, "Tags": []string{"x"}}, rsp)
+	assert.Equal(t, &helloResponse{Reply: "Hello bob", ID: 7}, rsp)
+	rsp = &helloResponse{}
+	c.Call(t, "GET", "/api/hello/7?name=bob&DryRun=true&Tags=x&id=1", nil, rsp)
+	assert.Equal(t, &helloResponse{Reply: "Hello bob", ID: 7}, rsp)
+}
+
+func TestContentNegotiation(t *testing.T) {
+	c := newTestClient(t, helloRoutes)
+	send := func(contentType, accept, body string) *fasthttp.Response {
+		return c.Send(t, "POST", "/api/hello/7", []byte(body), Header("Content-Type", contentType), Header("Accept", accept))
+	}
+
+	rsp := send("application/x-www-form-urlencoded", "application/xml, application/json;q=0.5", "name=bob")
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Equal(t, "application/xml", string(rsp.Header.ContentType()))
+	assert.Equal(t, "<helloResponse><Reply>Hello bob</Reply><ID>7</ID><DryRun>false</DryRun></helloResponse>", string(rsp.Body()))
+
+	rsp = send("application/xml", "*/*", "<helloRequest><Name>bob</Name></helloRequest>")
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Equal(t, "application/json", string(rsp.Header.ContentType()))
+
+	rsp = send("application/json", "application/msgpack", `{"name":"bob"}`)
+	assert.Equal(t, 200, rsp.StatusCode())
+	var m map[string]interface{}
+	assert.Nil(t, msgpack.Unmarshal(rsp.Body(), &m))
+	assert.Equal(t, "Hello bob", m["reply"])
+
+	rsp = send("text/plain", "", "bob")
+	assert.Equal(t, 415, rsp.StatusCode())
+	assert.Equal(t, "application/json", string(rsp.Header.ContentType()))
+
+	rsp = send("application/json", "text/html", `{"name":"bob"}`)
+	assert.Equal(t, 406, rsp.StatusCode())
+}
+
+func TestCompression(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		gofunc.POST(g, "/hello/{id}", hello)
+		gofunc.POST(g, "/raw/{id}", hello, gofunc.NoCompression())
+	}, gofunc.WithCompression(0))
+	send := func(path, contentEncoding, acceptEncoding string, body []byte) *fasthttp.Response {
+		return c.Send(t, "POST", path, body, Header("Content-Type", "application/json"),
+			Header("Content-Encoding", contentEncoding), Header("Accept-Encoding", acceptEncoding))
+	}
+
+	body := fasthttp.AppendGzipBytes(nil, []byte(`{"name":"bob"}`))
+	rsp := send("/api/hello/1", "gzip", "gzip;q=0.5, br", body)
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Equal(t, "br", string(rsp.Header.ContentEncoding()))
+	plain, err := rsp.BodyUnbrotli()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"reply":"Hello bob","id":1,"dryRun":false}`, string(plain))
+
+	rsp = send("/api/raw/1", "", "gzip", []byte(`{"name":"bob"}`))
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Empty(t, rsp.Header.ContentEncoding())
+
+	rsp = send("/api/hello/1", "compress", "", []byte(`{"name":"bob"}`))
+	assert.Equal(t, 415, rsp.StatusCode())
+	rsp = send("/api/hello/1", "gzip", "", []byte(`{"name":"bob"}`))
+	assert.Equal(t, 400, rsp.StatusCode())
+}
+
+func TestUpload(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		gofunc.POST(g, "/upload", upload, gofunc.MaxBodySize(1024))
+	})
+	send := func(content string) *fasthttp.Response {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		assert.Nil(t, w.WriteField("title", "report"))
+		part, err := w.CreateFormFile("file", "report.txt")
+		assert.Nil(t, err)
+		part.Write([]byte(content))
+		for _, name := range []string{"a.txt", "b.txt"} {
+			part, err = w.CreateFormFile("extra", name)
+			assert.Nil(t, err)
+			part.Write([]byte(name))
+		}
+		assert.Nil(t, w.Close())
+		return c.Send(t, "POST", "/api/upload", body.Bytes(), Header("Content-Type", w.FormDataContentType()))
+	}
+
+	rsp := send("hello")
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.JSONEq(t, `{"title":"report","name":"report.txt","content":"hello","extra":["a.txt","b.txt"]}`, string(rsp.Body()))
+
+	rsp = send(strings.Repeat("x", 2048))
+	assert.Equal(t, 413, rsp.StatusCode())
+
+	// files are only documented as multipart
+	doc := &struct {
+		Paths map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]json.RawMessage `json:"content"`
+			} `json:"requestBody"`
+		} `json:"paths"`
+	}{}
+	c.Call(t, "GET", "/api.json", nil, doc)
+	content := doc.Paths["/api/upload"]["post"].RequestBody.Content
+	assert.Len(t, content, 1)
+	assert.Contains(t, content, "multipart/form-data")
+}
+
+func TestDownload(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		gofunc.GET(g, "/export", export)
+		gofunc.GET(g, "/export/latest", exportLatest)
+	})
+	send := func(byteRange string) *fasthttp.Response {
+		opts := []RequestOption{Header("Accept", "text/plain")}
+		if byteRange != "" {
+			opts = append(opts, Header("Range", byteRange))
+		}
+		return c.Send(t, "GET", "/api/export?name=digits.txt", nil, opts...)
+	}
+
+	rsp := send("")
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Equal(t, "0123456789", string(rsp.Body()))
+	assert.Equal(t, "text/plain", string(rsp.Header.ContentType()))
+	assert.Equal(t, `attachment; filename=digits.txt`, string(rsp.Header.Peek("Content-Disposition")))
+
+	rsp = send("bytes=2-4")
+	assert.Equal(t, 206, rsp.StatusCode())
+	assert.Equal(t, "234", string(rsp.Body()))
+	assert.Equal(t, "bytes 2-4/10", string(rsp.Header.Peek("Content-Range")))
+
+	rsp = send("bytes=20-")
+	assert.Equal(t, 416, rsp.StatusCode())
+	assert.Equal(t, "bytes */10", string(rsp.Header.Peek("Content-Range")))
+
+	rsp = c.Send(t, "GET", "/api/export/latest", nil)
+	assert.Equal(t, 302, rsp.StatusCode())
+	assert.Equal(t, baseURL+"/api/export?name=digits.txt", string(rsp.Header.Peek("Location")))
+	assert.Empty(t, rsp.Body())
+}
+
+func TestEvents(t *testing.T) {
+	c := newTestClient(t, func(s *gofunc.Server, g *gofunc.Router) {
+		g.Events("/ticks", ticks, gofunc.Heartbeat(10*time.Millisecond))
+	})
+	c.CallError(t, "GET", "/api/ticks", nil, 400)
+
+	rsp := c.Send(t, "GET", "/api/ticks?count=3", nil, Header("Last-Event-ID", "1"))
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Equal(t, "text/event-stream", string(rsp.Header.ContentType()))
+
+	body := string(rsp.Body())
+	assert.True(t, strings.HasPrefix(body, "id: 2\nevent: tick\ndata: a\ndata: b\n\nid: 3\nevent: tick\ndata: a\ndata: b\n\n"), body)
+	assert.Contains(t, body, ": heartbeat\n\n")
+	assert.True(t, strings.HasSuffix(body, "event: error\ndata: {\"code\":4001,\"message\":\"no more ticks\"}\n\n"), body)
+}
+
+type traceRequest struct{}
+
+type traceResponse struct {
+	Trace []string `json:"trace"`
+}
+
+func traceHandler(ctx context.Context, req *traceRequest, rsp *traceResponse) error {
+	rsp.Trace = append(rsp.Trace, "handler")
+	return nil
+}
+
+// trace records name into traceResponse before the handler runs
+func trace(name string) middleware.Middleware {
+	return func(ctx context.Context, fastReq *fasthttp.RequestCtx, method middleware.MethodFunc, req, rsp interface{}) error {
+		if v, ok := rsp.(*traceResponse); ok {
+			v.Trace = append(v.Trace, name)
+		}
+		return method(ctx, req, rsp)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	s, err := gofunc.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Use(trace("server"))
+	s.ApiGroup("Root").Get("/ping", traceHandler)
+	users := s.ApiGroup("Users", "/api", "v1/").Use(trace("users"))
+	users.Get("/users", traceHandler)
+	admin := users.Group("/admin").Use(trace("admin"))
+	admin.Get("/stats", traceHandler)
+	users.Use(trace("late"))
+	users.Get("/me", traceHandler)
+	c := NewServer(t, s)
+
+	for path, want := range map[string][]string{
+		"/ping":               {"server", "handler"},
+		"/api/v1/users":       {"server", "users", "handler"},
+		"/api/v1/admin/stats": {"server", "users", "admin", "handler"},
+		"/api/v1/me":          {"server", "users", "late", "handler"},
+	} {
+		rsp := &traceResponse{}
+		c.Call(t, "GET", path, nil, rsp)
+		assert.Equal(t, want, rsp.Trace, path)
+	}
+	c.CallError(t, "GET", "/users", nil, 404)
+
+	doc := &struct {
+		Paths map[string]map[string]struct {
+			Tags []string `json:"tags"`
+		} `json:"paths"`
+	}{}
+	c.Call(t, "GET", "/api.json", nil, doc)
+	assert.Equal(t, []string{"Root"}, doc.Paths["/ping"]["get"].Tags)
+	assert.Equal(t, []string{"Users"}, doc.Paths["/api/v1/admin/stats"]["get"].Tags)
+}
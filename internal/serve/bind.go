@@ -0,0 +1,263 @@
+package serve
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Tags declaring the request source of a struct field. Untagged fields are decoded
+// from the body of POST, PUT and PATCH requests and from the query string otherwise.
+const (
+	pathTag   = "path"
+	queryTag  = "query"
+	headerTag = "header"
+	cookieTag = "cookie"
+)
+
+// isBoundField reports whether field declares its source instead of the body or query
+func isBoundField(field reflect.StructField) bool {
+	return field.Tag.Get(pathTag) != "" || field.Tag.Get(queryTag) != "" ||
+		field.Tag.Get(headerTag) != "" || field.Tag.Get(cookieTag) != ""
+}
+
+// boundField is a struct field populated from a named request value
+type boundField struct {
+	name     string
+	index    []int
+	typ      reflect.Type
+	required bool
+	comment  string
+}
+
+type boundFields []boundField
+
+// requestBindings are the request fields bound from path parameters, query, headers and cookies,
+// and the fields of multipart file parts
+type requestBindings struct {
+	path   boundFields
+	query  boundFields
+	header boundFields
+	cookie boundFields
+	files  boundFields
+}
+
+func newRequestBindings(reqType reflect.Type) requestBindings {
+	return requestBindings{
+		path:   fieldsByTag(reqType, pathTag),
+		query:  fieldsByTag(reqType, queryTag),
+		header: fieldsByTag(reqType, headerTag),
+		cookie: fieldsByTag(reqType, cookieTag),
+		files:  fileFields(reqType),
+	}
+}
+
+// checkPath returns an error if a path field names no {name} or *name segment of the route pattern
+func (b *requestBindings) checkPath(pattern string) error {
+	params := map[string]bool{}
+	for _, seg := range splitPath(pattern) {
+		if name, ok := paramName(seg); ok {
+			params[name] = true
+		}
+	}
+	for _, f := range b.path {
+		if !params[f.name] {
+			return fmt.Errorf("path parameter %s of the request is not in %s", f.name, pattern)
+		}
+	}
+	return nil
+}
+
+// bind populates req after the body has been decoded. Bound fields are zeroed first so that
+// the body or query string cannot set them, then sources are applied in the order
+// query, header, cookie, path so a later source overrides an earlier one.
+// The returned error is meant for the client.
+func (b *requestBindings) bind(fastReq *fasthttp.RequestCtx, req interface{}, params pathParams) error {
+	for _, fs := range []boundFields{b.query, b.header, b.cookie, b.path} {
+		fs.reset(req)
+	}
+	if len(b.query) > 0 {
+		args := fastReq.QueryArgs()
+		err := b.query.bind(req, func(name string) []string {
+			var ret []string
+			for _, v := range args.PeekMulti(name) {
+				ret = append(ret, string(v))
+			}
+			return ret
+		})
+		if err != nil {
+			return fmt.Errorf("Decode query failed: %v", err)
+		}
+	}
+	if len(b.header) > 0 {
+		err := b.header.bind(req, func(name string) []string {
+			if v := fastReq.Request.Header.Peek(name); v != nil {
+				return []string{string(v)}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Decode header failed: %v", err)
+		}
+	}
+	if len(b.cookie) > 0 {
+		err := b.cookie.bind(req, func(name string) []string {
+			if v := fastReq.Request.Header.Cookie(name); v != nil {
+				return []string{string(v)}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Decode cookie failed: %v", err)
+		}
+	}
+	if len(b.path) > 0 {
+		if err := b.path.bind(req, params.values); err != nil {
+			return fmt.Errorf("Decode path parameter failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// fieldsByTag collects the exported fields of struct type t carrying tag
+func fieldsByTag(t reflect.Type, tag string) boundFields {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var ret boundFields
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				for _, sub := range fieldsByTag(fieldType, tag) {
+					sub.index = append([]int{i}, sub.index...)
+					ret = append(ret, sub)
+				}
+				continue
+			}
+		}
+		if !unicode.IsUpper(rune(field.Name[0])) {
+			continue
+		}
+		name := field.Tag.Get(tag)
+		if idx := strings.IndexRune(name, ','); idx >= 0 {
+			name = name[:idx]
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		validateTag := field.Tag.Get("validate")
+		ret = append(ret, boundField{
+			name:     name,
+			index:    field.Index,
+			typ:      field.Type,
+			required: strings.HasSuffix(validateTag, "required") || strings.Contains(validateTag, "required,"),
+			comment:  field.Tag.Get("comment"),
+		})
+	}
+	return ret
+}
+
+// reset zeroes the fields of v
+func (fs boundFields) reset(v interface{}) {
+	if len(fs) == 0 {
+		return
+	}
+	rv := reflect.ValueOf(v).Elem()
+	for _, f := range fs {
+		fv := fieldByIndex(rv, f.index)
+		fv.Set(reflect.Zero(fv.Type()))
+	}
+}
+
+// bind sets every field whose values are found by get, slices take all values
+// and other types the last one
+func (fs boundFields) bind(v interface{}, get func(name string) []string) error {
+	rv := reflect.ValueOf(v).Elem()
+	for _, f := range fs {
+		values := get(f.name)
+		if len(values) == 0 {
+			continue
+		}
+		fv := fieldByIndex(rv, f.index)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+			for i, str := range values {
+				if err := setString(slice.Index(i), str); err != nil {
+					return fmt.Errorf("invalid value %q for %s: %v", str, f.name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		str := values[len(values)-1]
+		if err := setString(fv, str); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", str, f.name, err)
+		}
+	}
+	return nil
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func setString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package serve
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"strings"
+
+	json "github.com/goccy/go-json"
+	"github.com/gorilla/schema"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec decodes request bodies and encodes response bodies of one media type
+type Codec interface {
+	Decode(data []byte, v interface{}) error
+	Encode(v interface{}) ([]byte, error)
+}
+
+// Built-in media types
+const (
+	mediaTypeJSON    = "application/json"
+	mediaTypeForm    = "application/x-www-form-urlencoded"
+	mediaTypeXML     = "application/xml"
+	mediaTypeMsgPack = "application/msgpack"
+)
+
+// codecRegistry selects codecs by Content-Type and Accept.
+// It is written before serving only, so lookups are not locked.
+type codecRegistry struct {
+	// types in registration order, the first one is used when the client states no preference
+	types  []string
+	codecs map[string]Codec
+}
+
+func newCodecRegistry() *codecRegistry {
+	r := &codecRegistry{codecs: map[string]Codec{}}
+	r.register(mediaTypeJSON, jsonCodec{})
+	r.register(mediaTypeForm, formCodec{})
+	r.register(mediaTypeXML, xmlCodec{})
+	r.register(mediaTypeMsgPack, msgpackCodec{})
+	return r
+}
+
+func (r *codecRegistry) register(mediaType string, c Codec) {
+	mediaType = strings.ToLower(mediaType)
+	if _, ok := r.codecs[mediaType]; !ok {
+		r.types = append(r.types, mediaType)
+	}
+	r.codecs[mediaType] = c
+}
+
+// requestCodec selects the codec of a Content-Type header, the default one when it is empty
+func (r *codecRegistry) requestCodec(contentType []byte) Codec {
+	if len(contentType) == 0 {
+		return r.codecs[r.types[0]]
+	}
+	mediaType, _ := parseMediaRange(string(contentType))
+	return r.codecs[mediaType]
+}
+
+// responseCodec selects the media type and codec best matching an Accept header,
+// ties go to the earliest registered type. A nil codec means that none is acceptable.
+func (r *codecRegistry) responseCodec(accept []byte) (string, Codec) {
+	if len(accept) == 0 {
+		return r.types[0], r.codecs[r.types[0]]
+	}
+	parts := strings.Split(string(accept), ",")
+	// types refused with q=0 are not selected through a wildcard either
+	var refused []string
+	for _, part := range parts {
+		if mediaRange, q := parseMediaRange(part); q <= 0 {
+			refused = append(refused, mediaRange)
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, part := range parts {
+		mediaRange, q := parseMediaRange(part)
+		if q <= 0 || q < bestQ {
+			continue
+		}
+		if t := r.match(mediaRange, refused); t != "" && (q > bestQ || r.index(t) < r.index(best)) {
+			best, bestQ = t, q
+		}
+	}
+	if best == "" {
+		return "", nil
+	}
+	return best, r.codecs[best]
+}
+
+// index returns the registration order of mediaType
+func (r *codecRegistry) index(mediaType string) int {
+	for i, t := range r.types {
+		if t == mediaType {
+			return i
+		}
+	}
+	return len(r.types)
+}
+
+// match returns the first registered media type in mediaRange which is not refused
+func (r *codecRegistry) match(mediaRange string, refused []string) string {
+	if strings.HasSuffix(mediaRange, "/*") {
+		prefix := mediaRange[:len(mediaRange)-1]
+		if mediaRange == "*/*" {
+			prefix = ""
+		}
+		for _, t := range r.types {
+			if strings.HasPrefix(t, prefix) && !contains(refused, t) {
+				return t
+			}
+		}
+		return ""
+	}
+	if _, ok := r.codecs[mediaRange]; ok {
+		return mediaRange
+	}
+	return ""
+}
+
+// isTextMediaType reports whether messages of mediaType are text, e.g. to send them as websocket text frames
+func isTextMediaType(mediaType string) bool {
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == mediaTypeJSON, mediaType == mediaTypeForm, mediaType == mediaTypeXML,
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMediaRange splits "type/subtype; q=0.5" into the lower cased media type and its quality
+func parseMediaRange(s string) (string, float64) {
+	q := 1.0
+	mediaType, params, _ := strings.Cut(s, ";")
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if key == "q" {
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType)), q
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Encode(v interface{}) ([]byte, error)    { return json.Marshal(v) }
+
+// formCodec names fields by their json tag like query strings
+type formCodec struct{}
+
+func (formCodec) Decode(data []byte, v interface{}) error { return queryDecoder(data, v) }
+func (formCodec) Encode(v interface{}) ([]byte, error) {
+	values := url.Values{}
+	e := schema.NewEncoder()
+	e.SetAliasTag(filedNameTag)
+	if err := e.Encode(v, values); err != nil {
+		return nil, err
+	}
+	return []byte(values.Encode()), nil
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Decode(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+func (xmlCodec) Encode(v interface{}) ([]byte, error)    { return xml.Marshal(v) }
+
+// msgpackCodec names fields by their json tag unless a msgpack tag is given
+type msgpackCodec struct{}
+
+func (msgpackCodec) Decode(data []byte, v interface{}) error {
+	d := msgpack.NewDecoder(bytes.NewReader(data))
+	d.SetCustomStructTag(filedNameTag)
+	return d.Decode(v)
+}
+
+func (msgpackCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	e := msgpack.NewEncoder(&buf)
+	e.SetCustomStructTag(filedNameTag)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,43 @@
+package serve
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCodec(t *testing.T) {
+	r := newCodecRegistry()
+	for accept, want := range map[string]string{
+		"": mediaTypeJSON,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": mediaTypeXML,
+		"application/xml, application/json;q=0.5":                         mediaTypeXML,
+		"application/xml, application/json":                               mediaTypeJSON,
+		"application/*":                                                   mediaTypeJSON,
+		"application/msgpack, application/json":                           mediaTypeJSON,
+		"application/msgpack, application/json;q=0.5":                     mediaTypeMsgPack,
+		"application/json;q=0, */*":                                       mediaTypeForm,
+		"application/json;q=0, application/msgpack":                       mediaTypeMsgPack,
+		"text/html":            "",
+		"application/json;q=0": "",
+	} {
+		got, _ := r.responseCodec([]byte(accept))
+		assert.Equal(t, want, got, accept)
+	}
+}
+
+func TestIsTextMediaType(t *testing.T) {
+	for mediaType, want := range map[string]bool{
+		mediaTypeJSON:                 true,
+		mediaTypeForm:                 true,
+		mediaTypeXML:                  true,
+		"application/problem+json":    true,
+		"text/csv":                    true,
+		mediaTypeMsgPack:              false,
+		"application/protobuf":        false,
+		"application/octet-stream":    false,
+		"application/vnd.api+msgpack": false,
+	} {
+		assert.Equal(t, want, isTextMediaType(mediaType), mediaType)
+	}
+}
@@ -0,0 +1,131 @@
+package serve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	errBodyTooLarge        = errors.New("decompressed body too large")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// zstdEncoder is safe for concurrent EncodeAll
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// acceptEncoding selects the content coding of an Accept-Encoding header, empty for identity
+func acceptEncoding(header []byte) string {
+	if len(header) == 0 {
+		return ""
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(string(header), ",") {
+		coding, q := parseMediaRange(part)
+		if coding == "*" {
+			coding = "gzip"
+		}
+		if q <= bestQ {
+			continue
+		}
+		switch coding {
+		case "br", "zstd", "gzip":
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+func compressBody(coding string, body []byte) []byte {
+	switch coding {
+	case "br":
+		return fasthttp.AppendBrotliBytes(nil, body)
+	case "zstd":
+		return zstdEncoder.EncodeAll(body, nil)
+	default:
+		return fasthttp.AppendGzipBytes(nil, body)
+	}
+}
+
+// decompressBody decodes a request body of Content-Encoding coding up to limit bytes
+func decompressBody(coding string, body []byte, limit int) ([]byte, error) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(coding)) {
+	case "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		// one goroutine per request and no frame window larger than the limit
+		zr, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(limit)+1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("%w %s", errUnsupportedEncoding, coding)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return nil, errBodyTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, errBodyTooLarge
+	}
+	return out, nil
+}
+
+// readBody returns the request body decompressed by its Content-Encoding,
+// it returns false if the request has been answered
+func (s *Server) readBody(fastReq *fasthttp.RequestCtx) ([]byte, bool) {
+	body := fastReq.PostBody()
+	coding := fastReq.Request.Header.ContentEncoding()
+	if len(coding) == 0 || len(body) == 0 {
+		return body, true
+	}
+	limit := s.httpServer.MaxRequestBodySize
+	if limit <= 0 {
+		limit = fasthttp.DefaultMaxRequestBodySize
+	}
+	body, err := decompressBody(string(coding), body, limit)
+	switch {
+	case err == errBodyTooLarge:
+		writeRouteError(fastReq, 413, "Request body too large")
+	case errors.Is(err, errUnsupportedEncoding):
+		writeRouteError(fastReq, 415, err.Error())
+	case err != nil:
+		writeRouteError(fastReq, 400, "Decompress request body failed: "+err.Error())
+	default:
+		return body, true
+	}
+	return nil, false
+}
+
+// writeBody writes a response body, compressed when enabled for the route, large enough and accepted
+func (s *Server) writeBody(fastReq *fasthttp.RequestCtx, rt *route, body []byte) {
+	if s.compress && !rt.noCompress && len(body) >= s.compressMinSize {
+		fastReq.Response.Header.Add("Vary", "Accept-Encoding")
+		if coding := acceptEncoding(fastReq.Request.Header.Peek("Accept-Encoding")); coding != "" {
+			fastReq.Response.Header.Set("Content-Encoding", coding)
+			body = compressBody(coding, body)
+		}
+	}
+	fastReq.Write(body)
+}
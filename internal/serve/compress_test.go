@@ -0,0 +1,38 @@
+package serve
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDecompressBody(t *testing.T) {
+	plain := bytes.Repeat([]byte("a"), 4096)
+	for _, coding := range []string{"gzip", "br", "zstd"} {
+		body := compressBody(coding, plain)
+		out, err := decompressBody(coding, body, len(plain))
+		require.NoError(t, err, coding)
+		assert.Equal(t, plain, out, coding)
+
+		_, err = decompressBody(coding, body, len(plain)-1)
+		assert.Error(t, err, coding)
+	}
+
+	// a frame declaring a window larger than the limit is refused before decoding
+	w, err := zstd.NewWriter(nil, zstd.WithSingleSegment(false))
+	require.NoError(t, err)
+	frame := w.EncodeAll(plain[:512], nil)
+	var header zstd.Header
+	require.NoError(t, header.Decode(frame))
+	require.False(t, header.SingleSegment)
+	frame[5] = 10 << 3 // window descriptor of 1MB
+	_, err = decompressBody("zstd", frame, 1024)
+	assert.Equal(t, errBodyTooLarge, err)
+
+	_, err = decompressBody("compress", fasthttp.AppendGzipBytes(nil, plain), len(plain))
+	assert.ErrorIs(t, err, errUnsupportedEncoding)
+}
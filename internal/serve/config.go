@@ -0,0 +1,209 @@
+package serve
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Trailing slash modes for requests whose path differs from the route pattern only by a trailing slash
+const (
+	TrailingSlashStrict   = "strict"   // answer 404
+	TrailingSlashRedirect = "redirect" // redirect to the route pattern
+	TrailingSlashTolerate = "tolerate" // serve the route
+)
+
+type serveConfig struct {
+	Addr            string
+	SwaggerPath     string
+	Timeout         time.Duration
+	DrainTimeout    time.Duration
+	TrailingSlash   string
+	CaseInsensitive bool
+
+	// fasthttp.Server fields, zero means fasthttp default
+	Name               string
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	MaxRequestBodySize int
+	Concurrency        int
+	DisableKeepalive   bool
+
+	// TLS is enabled with CertFile and KeyFile, ClientCAFile enables client certificate verification
+	CertFile           string
+	KeyFile            string
+	ClientCAFile       string
+	ClientCertOptional bool
+
+	// ReusePort opens one SO_REUSEPORT listener per GOMAXPROCS
+	ReusePort bool
+
+	// Compress enables response compression for bodies of at least CompressMinSize bytes
+	Compress        bool
+	CompressMinSize int
+
+	envPrefix string
+	ignoreEnv bool
+}
+
+// Option configures a Server, options are documented on their gofunc wrappers.
+// Environment variables named by the config fields, SERVE_ADDR by default, take precedence.
+type Option func(*serveConfig)
+
+func newServeConfig(opts ...Option) (*serveConfig, error) {
+	cfg := &serveConfig{
+		Addr:          "127.0.0.1:9001",
+		SwaggerPath:   "/",
+		DrainTimeout:  10 * time.Second,
+		TrailingSlash: TrailingSlashRedirect,
+
+		CompressMinSize: 1024,
+
+		envPrefix: "serve",
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if !cfg.ignoreEnv {
+		if err := envconfig.Process(cfg.envPrefix, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Addr == "" || cfg.Addr == "unix:" {
+		return nil, fmt.Errorf("serve address is empty")
+	}
+	if cfg.ReusePort && strings.HasPrefix(cfg.Addr, "unix:") {
+		return nil, fmt.Errorf("reuseport is unsupported for unix socket %s", cfg.Addr)
+	}
+	switch cfg.TrailingSlash {
+	case TrailingSlashStrict, TrailingSlashRedirect, TrailingSlashTolerate:
+	default:
+		return nil, fmt.Errorf("invalid trailing slash mode %q", cfg.TrailingSlash)
+	}
+	if cfg.MaxRequestBodySize < 0 || cfg.Concurrency < 0 || cfg.CompressMinSize < 0 {
+		return nil, fmt.Errorf("max request body size, concurrency and compress min size should not be negative")
+	}
+	return cfg, nil
+}
+
+// IgnoreEnv skips environment variables
+func IgnoreEnv() Option {
+	return func(c *serveConfig) {
+		c.ignoreEnv = true
+	}
+}
+
+// WithEnvPrefix reads environment variables named prefix_FIELD instead of SERVE_FIELD
+func WithEnvPrefix(prefix string) Option {
+	return func(c *serveConfig) {
+		c.envPrefix = prefix
+	}
+}
+
+func WithAddr(addr string) Option {
+	return func(c *serveConfig) {
+		c.Addr = addr
+	}
+}
+
+func WithSwaggerPath(path string) Option {
+	return func(c *serveConfig) {
+		c.SwaggerPath = path
+	}
+}
+
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(c *serveConfig) {
+		c.Timeout = d
+	}
+}
+
+func WithDrainTimeout(d time.Duration) Option {
+	return func(c *serveConfig) {
+		c.DrainTimeout = d
+	}
+}
+
+func WithTrailingSlash(mode string) Option {
+	return func(c *serveConfig) {
+		c.TrailingSlash = mode
+	}
+}
+
+func WithCaseInsensitive(enabled bool) Option {
+	return func(c *serveConfig) {
+		c.CaseInsensitive = enabled
+	}
+}
+
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *serveConfig) {
+		c.ReadTimeout = d
+	}
+}
+
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *serveConfig) {
+		c.WriteTimeout = d
+	}
+}
+
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *serveConfig) {
+		c.IdleTimeout = d
+	}
+}
+
+func WithMaxRequestBodySize(size int) Option {
+	return func(c *serveConfig) {
+		c.MaxRequestBodySize = size
+	}
+}
+
+func WithConcurrency(n int) Option {
+	return func(c *serveConfig) {
+		c.Concurrency = n
+	}
+}
+
+func WithKeepAlive(enabled bool) Option {
+	return func(c *serveConfig) {
+		c.DisableKeepalive = !enabled
+	}
+}
+
+func WithName(name string) Option {
+	return func(c *serveConfig) {
+		c.Name = name
+	}
+}
+
+func WithTLS(certFile, keyFile string) Option {
+	return func(c *serveConfig) {
+		c.CertFile = certFile
+		c.KeyFile = keyFile
+	}
+}
+
+func WithClientCA(caFile string, optional bool) Option {
+	return func(c *serveConfig) {
+		c.ClientCAFile = caFile
+		c.ClientCertOptional = optional
+	}
+}
+
+func WithCompression(minSize int) Option {
+	return func(c *serveConfig) {
+		c.Compress = true
+		c.CompressMinSize = minSize
+	}
+}
+
+func WithReusePort(enabled bool) Option {
+	return func(c *serveConfig) {
+		c.ReusePort = enabled
+	}
+}
@@ -0,0 +1,61 @@
+package serve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	cfg, err := newServeConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9001", cfg.Addr)
+	assert.Equal(t, 10*time.Second, cfg.DrainTimeout)
+
+	cfg, err = newServeConfig(WithAddr(":8080"), WithReadTimeout(time.Second), WithKeepAlive(false))
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, time.Second, cfg.ReadTimeout)
+	assert.True(t, cfg.DisableKeepalive)
+
+	t.Setenv("SERVE_ADDR", ":9090")
+	t.Setenv("SERVE_READTIMEOUT", "3s")
+	cfg, err = newServeConfig(WithAddr(":8080"), WithReadTimeout(time.Second), WithName("api"))
+	require.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.Addr)
+	assert.Equal(t, 3*time.Second, cfg.ReadTimeout)
+	assert.Equal(t, "api", cfg.Name)
+
+	cfg, err = newServeConfig(WithAddr(":8080"), IgnoreEnv())
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+
+	t.Setenv("ADMIN_ADDR", ":9191")
+	cfg, err = newServeConfig(WithAddr(":8080"), WithEnvPrefix("admin"))
+	require.NoError(t, err)
+	assert.Equal(t, ":9191", cfg.Addr)
+	assert.Equal(t, time.Duration(0), cfg.ReadTimeout)
+}
+
+func TestConfigErrors(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"empty addr":      {WithAddr("")},
+		"unix reuseport":  {WithAddr("unix:/tmp/api.sock"), WithReusePort(true)},
+		"trailing slash":  {WithTrailingSlash("sometimes")},
+		"negative size":   {WithMaxRequestBodySize(-1)},
+		"missing key":     {WithTLS("cert.pem", "")},
+		"missing cert":    {WithTLS("missing.pem", "missing.key")},
+		"client ca alone": {WithClientCA("ca.pem", false)},
+	} {
+		_, err := NewServer(append(opts, IgnoreEnv())...)
+		assert.Error(t, err, name)
+	}
+
+	t.Setenv("SERVE_TIMEOUT", "soon")
+	_, err := NewServer()
+	assert.Error(t, err)
+	_, err = NewServer(IgnoreEnv())
+	assert.NoError(t, err)
+}
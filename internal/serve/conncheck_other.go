@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package serve
+
+import (
+	"context"
+	"net"
+)
+
+// watchConn does not detect disconnects on this platform, handlers rely on timeouts
+func watchConn(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return func() {}
+}
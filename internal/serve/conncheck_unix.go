@@ -0,0 +1,80 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// connCheckInterval is how often the connection of a running handler is checked for a disconnect
+const connCheckInterval = 200 * time.Millisecond
+
+// watchConn calls cancel once the client has closed conn, until stop is called.
+// fasthttp does not read while a handler runs, so the connection is peeked without consuming data.
+func watchConn(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	rc := rawConn(conn)
+	if rc == nil {
+		return func() {}
+	}
+	var mu sync.Mutex
+	var timer *time.Timer
+	stopped := false
+	mu.Lock()
+	defer mu.Unlock()
+	timer = time.AfterFunc(connCheckInterval, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+		if peerClosed(rc) {
+			cancel()
+			return
+		}
+		timer.Reset(connCheckInterval)
+	})
+	return func() {
+		mu.Lock()
+		stopped = true
+		timer.Stop()
+		mu.Unlock()
+	}
+}
+
+func rawConn(conn net.Conn) syscall.RawConn {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return rc
+}
+
+// peerClosed reports whether the peer has closed the connection, pending data means it is alive
+func peerClosed(rc syscall.RawConn) bool {
+	closed := false
+	var buf [1]byte
+	err := rc.Read(func(fd uintptr) bool {
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		switch {
+		case err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR:
+		case err != nil:
+			closed = true
+		default:
+			closed = n == 0
+		}
+		return true
+	})
+	return closed || err != nil
+}
@@ -0,0 +1,129 @@
+package serve
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const mediaTypeOctetStream = "application/octet-stream"
+
+// Download is a response type streaming Reader as the body instead of encoding a struct.
+// Readers implementing io.Seeker are served with range request support,
+// readers implementing io.Closer are closed once written.
+type Download struct {
+	Reader      io.Reader
+	ContentType string    // defaults to application/octet-stream
+	Name        string    // file name suggested by Content-Disposition
+	Inline      bool      // display in the browser instead of saving as attachment
+	Size        int64     // length of a reader without io.Seeker, unknown when zero
+	ModTime     time.Time // sets Last-Modified and validates If-Range
+}
+
+var downloadType = reflect.TypeOf(Download{})
+
+// readCloser keeps the Closer of a reader limited to a range
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// close releases the reader of a download answered without body, e.g. a redirect
+func (d *Download) close() {
+	if c, ok := d.Reader.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// writeDownload streams d as the response body
+func writeDownload(fastReq *fasthttp.RequestCtx, d *Download) {
+	if d.Reader == nil {
+		writeErrResponse(fastReq, errors.New("download reader is nil"))
+		return
+	}
+	h := &fastReq.Response.Header
+	contentType := d.ContentType
+	if contentType == "" {
+		contentType = mediaTypeOctetStream
+	}
+	h.Set("Content-Type", contentType)
+	if d.Name != "" || d.Inline {
+		disposition := "attachment"
+		if d.Inline {
+			disposition = "inline"
+		}
+		if d.Name != "" {
+			disposition = mime.FormatMediaType(disposition, map[string]string{"filename": d.Name})
+		}
+		h.Set("Content-Disposition", disposition)
+	}
+	if !d.ModTime.IsZero() {
+		h.SetLastModified(d.ModTime)
+	}
+
+	seeker, ok := d.Reader.(io.ReadSeeker)
+	if !ok {
+		size := int(d.Size)
+		if size <= 0 {
+			size = -1
+		}
+		fastReq.Response.SetBodyStream(d.Reader, size)
+		return
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = seeker.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		closeReader(d.Reader)
+		writeErrResponse(fastReq, err)
+		return
+	}
+	h.Set("Accept-Ranges", "bytes")
+
+	byteRange := fastReq.Request.Header.Peek("Range")
+	if len(byteRange) == 0 || bytes.IndexByte(byteRange, ',') >= 0 || !ifRange(fastReq, d.ModTime) {
+		// multiple ranges are answered with the whole body
+		fastReq.Response.SetBodyStream(seeker, int(size))
+		return
+	}
+	start, end, err := fasthttp.ParseByteRange(byteRange, int(size))
+	if err == nil {
+		_, err = seeker.Seek(int64(start), io.SeekStart)
+	}
+	if err != nil {
+		closeReader(d.Reader)
+		h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		writeRouteError(fastReq, fasthttp.StatusRequestedRangeNotSatisfiable, "Range not satisfiable: "+string(byteRange))
+		return
+	}
+	var body io.Reader = io.LimitReader(seeker, int64(end-start+1))
+	if closer, ok := d.Reader.(io.Closer); ok {
+		body = readCloser{Reader: body, Closer: closer}
+	}
+	fastReq.Response.SetStatusCode(fasthttp.StatusPartialContent)
+	h.SetContentRange(start, end, int(size))
+	fastReq.Response.SetBodyStream(body, end-start+1)
+}
+
+// ifRange reports whether a Range header applies, If-Range only supports dates
+func ifRange(fastReq *fasthttp.RequestCtx, modTime time.Time) bool {
+	value := fastReq.Request.Header.Peek("If-Range")
+	if len(value) == 0 {
+		return true
+	}
+	t, err := fasthttp.ParseHTTPDate(value)
+	return err == nil && !modTime.IsZero() && !modTime.Truncate(time.Second).After(t)
+}
+
+func closeReader(r io.Reader) {
+	if closer, ok := r.(io.Closer); ok {
+		closer.Close()
+	}
+}
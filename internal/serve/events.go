@@ -0,0 +1,191 @@
+package serve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ottstack/gofunc/pkg/ecode"
+	"github.com/ottstack/gofunc/pkg/reqctx"
+	"github.com/ottstack/gofunc/pkg/sse"
+	"github.com/valyala/fasthttp"
+)
+
+const mediaTypeEventStream = "text/event-stream"
+
+// defaultHeartbeat is the interval of comments keeping idle event streams open through proxies
+const defaultHeartbeat = 15 * time.Second
+
+var errStreamClosed = errors.New("event stream closed")
+
+var sendEventsType = reflect.TypeOf((*sse.SendStream)(nil)).Elem()
+
+var lineBreaks = strings.NewReplacer("\r", "", "\n", "")
+
+// eventStream implements sse.SendStream over the body stream writer of a response.
+// The handler runs in the writer, after the middlewares have returned.
+type eventStream struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	err error // set once the client is gone or the stream is closed
+
+	lastEventID string
+	heartbeat   time.Duration
+	streams     *int64
+	cancel      context.CancelFunc
+	started     bool
+}
+
+// prepare reads the request state needed once the response is being written
+func (e *eventStream) prepare(fastReq *fasthttp.RequestCtx, heartbeat time.Duration, streams *int64) {
+	e.lastEventID = string(fastReq.Request.Header.Peek("Last-Event-ID"))
+	e.heartbeat = heartbeat
+	e.streams = streams
+}
+
+// release cancels the handler context unless the stream has started and owns it
+func (e *eventStream) release() {
+	if !e.started {
+		e.cancel()
+	}
+}
+
+func (e *eventStream) LastEventID() string {
+	return e.lastEventID
+}
+
+func (e *eventStream) Send(data []byte) error {
+	return e.SendEvent(sse.Event{Data: data})
+}
+
+func (e *eventStream) SendEvent(ev sse.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return e.err
+	}
+	if ev.ID != "" {
+		e.writeField("id", ev.ID)
+	}
+	if ev.Event != "" {
+		e.writeField("event", ev.Event)
+	}
+	if ev.Retry > 0 {
+		e.writeField("retry", strconv.FormatInt(ev.Retry.Milliseconds(), 10))
+	}
+	if len(ev.Data) > 0 {
+		for _, line := range bytes.Split(ev.Data, []byte("\n")) {
+			e.w.WriteString("data: ")
+			e.w.Write(bytes.TrimSuffix(line, []byte("\r")))
+			e.w.WriteByte('\n')
+		}
+	}
+	e.w.WriteByte('\n')
+	return e.flush()
+}
+
+// writeField writes a single line field, line breaks would end the field early
+func (e *eventStream) writeField(name, value string) {
+	e.w.WriteString(name)
+	e.w.WriteString(": ")
+	e.w.WriteString(lineBreaks.Replace(value))
+	e.w.WriteByte('\n')
+}
+
+func (e *eventStream) flush() error {
+	if err := e.w.Flush(); err != nil {
+		// client is gone, notify the handler through its context
+		e.err = err
+		e.cancel()
+	}
+	return e.err
+}
+
+// sendError sends err as an "error" event, the status line has already been written
+func (e *eventStream) sendError(err error) {
+	if _, ok := err.(*ecode.APIError); !ok {
+		err = ecode.Errorf(500, err.Error())
+	}
+	bs, _ := encoder(err)
+	e.SendEvent(sse.Event{Event: "error", Data: bs})
+}
+
+// keepAlive sends heartbeat comments until ctx or done
+func (e *eventStream) keepAlive(ctx context.Context, done <-chan struct{}) {
+	if e.heartbeat <= 0 {
+		return
+	}
+	ticker := time.NewTicker(e.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.mu.Lock()
+			err := e.err
+			if err == nil {
+				e.w.WriteString(": heartbeat\n\n")
+				err = e.flush()
+			}
+			e.mu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// start answers with the event stream, handler runs once the response headers are written
+func (e *eventStream) start(ctx context.Context, handler func(context.Context) error) error {
+	fastReq := reqctx.RequestCtx(ctx)
+	h := &fastReq.Response.Header
+	h.SetContentType(mediaTypeEventStream)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	e.started = true
+	fastReq.SetBodyStreamWriter(func(w *bufio.Writer) {
+		atomic.AddInt64(e.streams, 1)
+		defer atomic.AddInt64(e.streams, -1)
+		defer e.cancel()
+
+		e.mu.Lock()
+		e.w = w
+		e.flush()
+		e.mu.Unlock()
+		defer func() {
+			e.mu.Lock()
+			e.err = errStreamClosed
+			e.mu.Unlock()
+		}()
+
+		done := make(chan struct{})
+		defer close(done)
+		go e.keepAlive(ctx, done)
+
+		defer func() {
+			if r := recover(); r != nil {
+				buf := make([]byte, 5*1024)
+				buf = buf[:runtime.Stack(buf, false)]
+				log.Printf("panic: %v\n %s", r, string(buf))
+				e.sendError(fmt.Errorf("panic: %v", r))
+			}
+		}()
+		if err := handler(ctx); err != nil {
+			e.sendError(err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,73 @@
+package serve
+
+import (
+	"sort"
+	"strings"
+)
+
+type prefixMapping struct {
+	from string
+	to   string
+}
+
+// pathMapper rewrites external paths onto registered routes.
+// A mapping is either exact, like "/hello" -> "/api/hello",
+// or a prefix rewrite ending with "/*", like "/v1/*" -> "/api/*".
+type pathMapper struct {
+	exact    map[string]string
+	prefixes []prefixMapping
+}
+
+func newPathMapper(m map[string]string) *pathMapper {
+	pm := &pathMapper{exact: map[string]string{}}
+	for from, to := range m {
+		if strings.HasSuffix(from, "/*") && strings.HasSuffix(to, "/*") {
+			pm.prefixes = append(pm.prefixes, prefixMapping{from: from[:len(from)-1], to: to[:len(to)-1]})
+			continue
+		}
+		pm.exact[from] = to
+	}
+	// longest prefix first
+	sort.Slice(pm.prefixes, func(i, j int) bool {
+		return len(pm.prefixes[i].from) > len(pm.prefixes[j].from)
+	})
+	return pm
+}
+
+func (pm *pathMapper) rewrite(path string) string {
+	if pm == nil {
+		return path
+	}
+	if to, ok := pm.exact[path]; ok {
+		return to
+	}
+	for _, p := range pm.prefixes {
+		if strings.HasPrefix(path, p.from) {
+			return p.to + path[len(p.from):]
+		}
+		if path == p.from[:len(p.from)-1] {
+			return p.to[:len(p.to)-1]
+		}
+	}
+	return path
+}
+
+// aliases returns the external paths mapped onto path
+func (pm *pathMapper) aliases(path string) []string {
+	if pm == nil {
+		return nil
+	}
+	var ret []string
+	for from, to := range pm.exact {
+		if to == path {
+			ret = append(ret, from)
+		}
+	}
+	for _, p := range pm.prefixes {
+		if strings.HasPrefix(path, p.to) {
+			ret = append(ret, p.from+path[len(p.to):])
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
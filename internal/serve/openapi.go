@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -22,6 +23,8 @@ type openapi struct {
 	docHTML     []byte
 
 	namePkg map[string]string
+	// negotiated operations have their bodies encoded by the selected codec
+	negotiated []*openapi3.Operation
 }
 
 func newOpenapi(path string) *openapi {
@@ -44,22 +47,46 @@ func newOpenapi(path string) *openapi {
 }
 
 func (o *openapi) addMethod(info *methodInfo) {
+	if info.isWebsocket && info.reqType.Kind() == reflect.Struct {
+		o.addTypedStream(info)
+		return
+	}
 	rspContent := openapi3.Content{"application/json": {
 		Schema: &openapi3.SchemaRef{
 			Ref: schemaPrefix + info.operationId + info.rspType.Name(),
 		},
 	},
 	}
+	isDownload := info.rspType == downloadType
+	if isDownload {
+		rspContent = openapi3.Content{mediaTypeOctetStream: {
+			Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "string", Format: "binary"}},
+		}}
+	}
+	if info.isEvents {
+		rspContent = openapi3.Content{mediaTypeEventStream: {
+			Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{
+				Type:        "string",
+				Description: "Server-sent events, failures are sent as an \"error\" event with an APIError",
+			}},
+		}}
+	}
 
+	status := info.status
+	if status == 0 {
+		status = 200
+	}
+	successRsp := &openapi3.Response{Content: rspContent}
+	if noBody(status) {
+		successRsp = &openapi3.Response{}
+	}
 	oper := &openapi3.Operation{
 		OperationID: info.operationId,
 		Tags:        info.tags,
 		Summary:     info.summary,
 		Responses: openapi3.Responses{
-			"200": &openapi3.ResponseRef{
-				Value: &openapi3.Response{
-					Content: rspContent,
-				},
+			strconv.Itoa(status): &openapi3.ResponseRef{
+				Value: successRsp,
 			},
 			"default": &openapi3.ResponseRef{
 				Value: &openapi3.Response{
@@ -74,10 +101,15 @@ func (o *openapi) addMethod(info *methodInfo) {
 		},
 	}
 
-	if info.httpMethod == "PUT" || info.httpMethod == "POST" {
+	if hasBody(info.httpMethod) {
+		// files can only be uploaded as multipart, other codecs are added to JSON bodies
+		bodyType := mediaTypeJSON
+		if len(info.bindings.files) > 0 {
+			bodyType = mediaTypeMultipart
+		}
 		oper.RequestBody = &openapi3.RequestBodyRef{
 			Value: &openapi3.RequestBody{
-				Content: openapi3.Content{"application/json": {
+				Content: openapi3.Content{bodyType: {
 					Schema: &openapi3.SchemaRef{
 						Ref: schemaPrefix + info.operationId + info.reqType.Name(),
 					},
@@ -88,22 +120,129 @@ func (o *openapi) addMethod(info *methodInfo) {
 	} else {
 		oper.Parameters = o.buildParameter(info.operationId, info.reqType)
 	}
+	oper.Parameters = append(oper.Parameters, o.boundParameters("path", info.operationId, info.bindings.path)...)
+	oper.Parameters = append(oper.Parameters, o.boundParameters("query", info.operationId, info.bindings.query)...)
+	oper.Parameters = append(oper.Parameters, o.boundParameters("header", info.operationId, info.bindings.header)...)
+	oper.Parameters = append(oper.Parameters, o.boundParameters("cookie", info.operationId, info.bindings.cookie)...)
+
+	path := openapiPath(info.path)
+	if _, ok := o.model.Paths[path]; !ok {
+		o.model.Paths[path] = &openapi3.PathItem{}
+	}
 
-	if _, ok := o.model.Paths[info.path]; !ok {
-		o.model.Paths[info.path] = &openapi3.PathItem{}
+	o.model.Paths[path].SetOperation(info.httpMethod, oper)
+	if !info.isWebsocket {
+		o.negotiated = append(o.negotiated, oper)
 	}
 
-	if info.httpMethod == "GET" {
-		o.model.Paths[info.path].Get = oper
-	} else if info.httpMethod == "DELETE" {
-		o.model.Paths[info.path].Delete = oper
-	} else if info.httpMethod == "PUT" {
-		o.model.Paths[info.path].Put = oper
-	} else if info.httpMethod == "POST" {
-		o.model.Paths[info.path].Post = oper
+	if !isDownload && !info.isEvents {
+		o.parseType(info.operationId, info.rspType)
 	}
+}
 
+// addTypedStream documents the messages of a typed websocket stream, those sent by the server
+// as the 101 response and those sent by the client as the x-messages-in extension
+func (o *openapi) addTypedStream(info *methodInfo) {
+	description := "Messages sent by the server"
+	oper := &openapi3.Operation{
+		OperationID: info.operationId,
+		Tags:        info.tags,
+		Summary:     info.summary,
+		Description: "Websocket stream, x-messages-in describes the messages sent by the client",
+		Responses: openapi3.Responses{
+			"101": &openapi3.ResponseRef{
+				Value: &openapi3.Response{
+					Description: &description,
+					Content: openapi3.Content{mediaTypeJSON: {
+						Schema: &openapi3.SchemaRef{Ref: schemaPrefix + info.operationId + info.rspType.Name()},
+					}},
+				},
+			},
+			"default": &openapi3.ResponseRef{
+				Value: &openapi3.Response{
+					Content: openapi3.Content{mediaTypeJSON: {
+						Schema: &openapi3.SchemaRef{Ref: schemaPrefix + "APIError"},
+					}},
+				},
+			},
+		},
+	}
+	oper.Extensions = map[string]interface{}{
+		"x-messages-in": &openapi3.SchemaRef{Ref: schemaPrefix + info.operationId + info.reqType.Name()},
+	}
+	o.parseType(info.operationId, info.reqType)
 	o.parseType(info.operationId, info.rspType)
+
+	path := openapiPath(info.path)
+	if _, ok := o.model.Paths[path]; !ok {
+		o.model.Paths[path] = &openapi3.PathItem{}
+	}
+	o.model.Paths[path].SetOperation(info.httpMethod, oper)
+	o.negotiated = append(o.negotiated, oper)
+}
+
+// addAliases documents the external paths of a path mapping as copies of their routes
+func (o *openapi) addAliases(pm *pathMapper) {
+	paths := make([]string, 0, len(o.model.Paths))
+	for path := range o.model.Paths {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		for _, alias := range pm.aliases(path) {
+			if _, ok := o.model.Paths[alias]; ok {
+				continue
+			}
+			item := &openapi3.PathItem{}
+			for method, oper := range o.model.Paths[path].Operations() {
+				aliasOper := *oper
+				aliasOper.OperationID = operationID(method, alias)
+				aliasOper.Description = "Alias of " + path
+				item.SetOperation(method, &aliasOper)
+			}
+			o.model.Paths[alias] = item
+		}
+	}
+}
+
+// addMediaTypes documents the request and success bodies of negotiated operations in every media type
+func (o *openapi) addMediaTypes(types []string) {
+	for _, oper := range o.negotiated {
+		if oper.RequestBody != nil {
+			addContentTypes(oper.RequestBody.Value.Content, types)
+		}
+		for code, rsp := range oper.Responses {
+			if code != "default" {
+				addContentTypes(rsp.Value.Content, types)
+			}
+		}
+	}
+}
+
+func addContentTypes(content openapi3.Content, types []string) {
+	mediaType := content[mediaTypeJSON]
+	if mediaType == nil {
+		return
+	}
+	for _, t := range types {
+		if content[t] == nil {
+			content[t] = mediaType
+		}
+	}
+}
+
+func (o *openapi) boundParameters(in, namespace string, fields boundFields) openapi3.Parameters {
+	ret := openapi3.Parameters{}
+	for _, f := range fields {
+		p := &openapi3.Parameter{
+			In:          in,
+			Name:        f.name,
+			Schema:      o.parseType(namespace, f.typ),
+			Required:    in == "path" || f.required,
+			Description: f.comment,
+		}
+		ret = append(ret, &openapi3.ParameterRef{Value: p})
+	}
+	return ret
 }
 
 func (o *openapi) buildParameter(namespace string, reqType reflect.Type) openapi3.Parameters {
@@ -175,6 +314,9 @@ func (o *openapi) parseType(namespace string, rType reflect.Type) *openapi3.Sche
 	if elemType.Kind() == reflect.Ptr { // pointer to struct
 		elemType = rType.Elem()
 	}
+	if elemType == fileType {
+		return &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "string", Format: "binary"}}
+	}
 
 	var apiType string
 	var subType *openapi3.SchemaRef
@@ -232,6 +374,10 @@ func (o *openapi) parseType(namespace string, rType reflect.Type) *openapi3.Sche
 					if !unicode.IsUpper(rune(field.Name[0])) {
 						continue
 					}
+					// bound from path, header or cookie instead of body or query
+					if isBoundField(field) {
+						continue
+					}
 
 					fieldTag := field.Tag.Get(filedNameTag)
 					if fieldTag == "-" {
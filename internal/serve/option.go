@@ -0,0 +1,76 @@
+package serve
+
+import (
+	"time"
+
+	"github.com/ottstack/gofunc/pkg/middleware"
+)
+
+// RouteOption customizes a single route
+type RouteOption func(*routeOptions)
+
+type routeOptions struct {
+	timeout time.Duration
+	status  int
+	pooled  bool
+
+	noCompress  bool
+	maxBodySize int
+	heartbeat   time.Duration
+
+	middlewares []middleware.Middleware
+}
+
+// WithTimeout sets the deadline of the request context, overriding SERVE_TIMEOUT.
+// Websocket and event streams have no deadline without it.
+func WithTimeout(d time.Duration) RouteOption {
+	return func(o *routeOptions) {
+		o.timeout = d
+	}
+}
+
+// WithStatus sets the default status code of successful responses, e.g. 201 or 204,
+// and documents it in place of 200
+func WithStatus(code int) RouteOption {
+	return func(o *routeOptions) {
+		o.status = code
+	}
+}
+
+// WithMiddlewares wraps the route with mws inside the server middlewares
+func WithMiddlewares(mws ...middleware.Middleware) RouteOption {
+	return func(o *routeOptions) {
+		o.middlewares = append(o.middlewares, mws...)
+	}
+}
+
+// WithoutCompression never compresses responses of the route, e.g. for already compressed content
+func WithoutCompression() RouteOption {
+	return func(o *routeOptions) {
+		o.noCompress = true
+	}
+}
+
+// WithMaxBodySize answers 413 to requests of the route with a body larger than size bytes,
+// e.g. for uploads, before reading a body whose Content-Length exceeds it.
+// The server wide MaxRequestBodySize still applies.
+func WithMaxBodySize(size int) RouteOption {
+	return func(o *routeOptions) {
+		o.maxBodySize = size
+	}
+}
+
+// WithHeartbeat sets the interval of heartbeat comments on an event stream, zero disables them
+func WithHeartbeat(d time.Duration) RouteOption {
+	return func(o *routeOptions) {
+		o.heartbeat = d
+	}
+}
+
+// WithPool reuses request and response values of the route through a sync.Pool.
+// Handlers must not keep references to them after returning.
+func WithPool() RouteOption {
+	return func(o *routeOptions) {
+		o.pooled = true
+	}
+}
@@ -0,0 +1,57 @@
+package serve
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Resetter is implemented by pooled request or response types that hold slices or maps,
+// Reset is called instead of zeroing before the value is reused
+type Resetter interface {
+	Reset()
+}
+
+type argsPool struct {
+	req sync.Pool
+	rsp sync.Pool
+}
+
+func newArgsPool(factory methodFactory) *argsPool {
+	p := &argsPool{}
+	p.req.New = func() interface{} {
+		req, _ := factory()
+		return req
+	}
+	p.rsp.New = func() interface{} {
+		_, rsp := factory()
+		return rsp
+	}
+	return p
+}
+
+// newArgs returns the request and response values of a call
+func (rt *route) newArgs() (interface{}, interface{}) {
+	if rt.pool == nil {
+		return rt.factory()
+	}
+	return rt.pool.req.Get(), rt.pool.rsp.Get()
+}
+
+// release gives req and rsp back to the route pool once the response is written
+func (rt *route) release(req, rsp interface{}) {
+	if rt.pool == nil {
+		return
+	}
+	rt.pool.req.Put(resetValue(req))
+	rt.pool.rsp.Put(resetValue(rsp))
+}
+
+func resetValue(v interface{}) interface{} {
+	if r, ok := v.(Resetter); ok {
+		r.Reset()
+		return v
+	}
+	rv := reflect.ValueOf(v).Elem()
+	rv.Set(reflect.Zero(rv.Type()))
+	return v
+}
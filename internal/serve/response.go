@@ -1,7 +1,6 @@
 package serve
 
 import (
-	"fmt"
 	"net/url"
 
 	json "github.com/goccy/go-json"
@@ -11,24 +10,35 @@ import (
 )
 
 var encoder = json.Marshal
-var jsonDecoder = json.Unmarshal
 var queryDecoder = func(queryStr []byte, v interface{}) error {
 	u, err := url.ParseQuery(string(queryStr))
 	if err != nil {
 		return err
 	}
+	return valuesDecoder(u, v)
+}
+
+// valuesDecoder decodes form values into v naming fields by their json tag
+func valuesDecoder(u url.Values, v interface{}) error {
 	d := schema.NewDecoder()
 	d.SetAliasTag(filedNameTag)
 	d.IgnoreUnknownKeys(true)
 	return d.Decode(v, u)
 }
 
+// writeErrResponse answers err as a JSON encoded APIError whatever the negotiated codec
 func writeErrResponse(w *fasthttp.RequestCtx, err error) {
 	if _, ok := err.(*ecode.APIError); !ok {
 		err = ecode.Errorf(500, err.Error())
 	}
 	w.Response.SetStatusCode(ecode.ToHttpCode(err))
+	w.Response.Header.Set("Content-Type", mediaTypeJSON)
 	bs, _ := encoder(err)
-	fmt.Println("")
 	w.Write(bs)
 }
+
+// writeRouteError answers routing failures such as 404 and 405 with the same http status
+func writeRouteError(w *fasthttp.RequestCtx, code int, message string) {
+	writeErrResponse(w, &ecode.APIError{Code: code, Message: message})
+	w.Response.SetStatusCode(code)
+}
@@ -0,0 +1,261 @@
+package serve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ottstack/gofunc/pkg/middleware"
+)
+
+// route is a registered handler for one method and path pattern
+type route struct {
+	method      string
+	path        string
+	factory     methodFactory
+	pool        *argsPool
+	call        middleware.MethodFunc
+	handler     atomic.Value // middleware.MethodFunc, call wrapped by server middlewares
+	isWebsocket bool
+	isDownload  bool
+	isEvents    bool
+	heartbeat   time.Duration
+	bindings    requestBindings
+	timeout     time.Duration
+	status      int
+	noCompress  bool
+	maxBodySize int
+
+	trailingSlash bool // pattern ends with "/"
+	catchAll      bool // pattern ends with a catch-all
+}
+
+type pathParam struct {
+	key   string
+	value string
+}
+
+type pathParams []pathParam
+
+func (p pathParams) get(key string) (string, bool) {
+	for i := range p {
+		if p[i].key == key {
+			return p[i].value, true
+		}
+	}
+	return "", false
+}
+
+// values returns the value of key as the single value of a bound field
+func (p pathParams) values(key string) []string {
+	if v, ok := p.get(key); ok {
+		return []string{v}
+	}
+	return nil
+}
+
+// node is a path segment in the route tree.
+// Static segments take priority over {name} segments, which take priority over * catch-alls.
+type node struct {
+	static   map[string]*node
+	param    *node
+	catchAll *node
+	name     string
+
+	routes map[string]*route
+	allow  string // value of Allow header
+}
+
+type router struct {
+	root            *node
+	caseInsensitive bool
+}
+
+func newRouter() *router {
+	return &router{root: &node{}}
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// paramName returns the name of {name} or *name segment
+func paramName(seg string) (string, bool) {
+	if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") && len(seg) > 2 {
+		return seg[1 : len(seg)-1], true
+	}
+	if strings.HasPrefix(seg, "*") {
+		if seg == "*" {
+			return "path", true
+		}
+		return seg[1:], true
+	}
+	return "", false
+}
+
+func (r *router) add(rt *route) error {
+	segs := splitPath(rt.path)
+	n := r.root
+	for i, seg := range segs {
+		name, isParam := paramName(seg)
+		switch {
+		case isParam && seg[0] == '*':
+			if i != len(segs)-1 {
+				return fmt.Errorf("catch-all %s must be the last segment in %s", seg, rt.path)
+			}
+			if n.catchAll == nil {
+				n.catchAll = &node{name: name}
+			} else if n.catchAll.name != name {
+				return fmt.Errorf("catch-all %s in %s conflicts with *%s", seg, rt.path, n.catchAll.name)
+			}
+			n = n.catchAll
+			rt.catchAll = true
+		case isParam:
+			if n.param == nil {
+				n.param = &node{name: name}
+			} else if n.param.name != name {
+				return fmt.Errorf("path parameter %s in %s conflicts with {%s}", seg, rt.path, n.param.name)
+			}
+			n = n.param
+		default:
+			if n.static == nil {
+				n.static = map[string]*node{}
+			}
+			child, ok := n.static[seg]
+			if !ok {
+				child = &node{}
+				n.static[seg] = child
+			}
+			n = child
+		}
+	}
+	if n.routes == nil {
+		n.routes = map[string]*route{}
+	}
+	rt.trailingSlash = len(segs) > 0 && strings.HasSuffix(rt.path, "/")
+	if _, ok := n.routes[rt.method]; ok {
+		return fmt.Errorf("%s %s already registered", rt.method, rt.path)
+	}
+	n.routes[rt.method] = rt
+	n.allow = n.allowMethods()
+	return nil
+}
+
+// lookup returns the route of method, HEAD is served by GET routes
+func (n *node) lookup(method string) *route {
+	rt := n.routes[method]
+	if rt == nil && method == "HEAD" {
+		if get := n.routes["GET"]; get != nil && !get.isWebsocket && !get.isEvents {
+			return get
+		}
+	}
+	return rt
+}
+
+func (n *node) allowMethods() string {
+	methods := []string{"OPTIONS"}
+	for method, rt := range n.routes {
+		if method == "OPTIONS" {
+			continue
+		}
+		methods = append(methods, method)
+		if method == "GET" && !rt.isWebsocket && !rt.isEvents && n.routes["HEAD"] == nil {
+			methods = append(methods, "HEAD")
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// walk calls fn for every registered route
+func (r *router) walk(fn func(*route)) {
+	r.root.walk(fn)
+}
+
+func (n *node) walk(fn func(*route)) {
+	for _, rt := range n.routes {
+		fn(rt)
+	}
+	for _, child := range n.static {
+		child.walk(fn)
+	}
+	if n.param != nil {
+		n.param.walk(fn)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(fn)
+	}
+}
+
+// lookup finds the node matching path and collects the path parameters
+func (r *router) lookup(path string) (*node, pathParams) {
+	segs := splitPath(path)
+	var params pathParams
+	n := r.root.match(segs, &params, r.caseInsensitive)
+	return n, params
+}
+
+func (n *node) match(segs []string, params *pathParams, fold bool) *node {
+	if len(segs) == 0 {
+		if n.routes != nil {
+			return n
+		}
+		if n.catchAll != nil && n.catchAll.routes != nil {
+			*params = append(*params, pathParam{key: n.catchAll.name})
+			return n.catchAll
+		}
+		return nil
+	}
+	seg := segs[0]
+	if child, ok := n.static[seg]; ok {
+		if found := child.match(segs[1:], params, fold); found != nil {
+			return found
+		}
+	} else if fold {
+		for key, child := range n.static {
+			if !strings.EqualFold(key, seg) {
+				continue
+			}
+			if found := child.match(segs[1:], params, fold); found != nil {
+				return found
+			}
+		}
+	}
+	if n.param != nil && seg != "" {
+		mark := len(*params)
+		*params = append(*params, pathParam{key: n.param.name, value: seg})
+		if found := n.param.match(segs[1:], params, fold); found != nil {
+			return found
+		}
+		*params = (*params)[:mark]
+	}
+	if n.catchAll != nil && n.catchAll.routes != nil {
+		*params = append(*params, pathParam{key: n.catchAll.name, value: strings.Join(segs, "/")})
+		return n.catchAll
+	}
+	return nil
+}
+
+// openapiPath converts a route pattern to OpenAPI path template
+func openapiPath(path string) string {
+	segs := splitPath(path)
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, "*") {
+			name, _ := paramName(seg)
+			segs[i] = "{" + name + "}"
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+// operationID builds an identifier usable as schema namespace
+func operationID(method, path string) string {
+	r := strings.NewReplacer("/", "_", "{", "", "}", "", "*", "")
+	return method + r.Replace(path)
+}
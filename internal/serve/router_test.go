@@ -0,0 +1,131 @@
+package serve
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterLookup(t *testing.T) {
+	r := newRouter()
+	assert.Nil(t, r.add(&route{method: "GET", path: "/api/users"}))
+	assert.Nil(t, r.add(&route{method: "GET", path: "/api/users/{id}"}))
+	assert.Nil(t, r.add(&route{method: "GET", path: "/api/users/me"}))
+	assert.Nil(t, r.add(&route{method: "GET", path: "/static/*filepath"}))
+	assert.NotNil(t, r.add(&route{method: "GET", path: "/api/users/{name}"}))
+	assert.NotNil(t, r.add(&route{method: "GET", path: "/api/*rest/x"}))
+	assert.NotNil(t, r.add(&route{method: "GET", path: "/api/users"}))
+
+	n, params := r.lookup("/api/users/me")
+	assert.Equal(t, "/api/users/me", n.routes["GET"].path)
+	assert.Len(t, params, 0)
+
+	n, params = r.lookup("/api/users/42")
+	assert.Equal(t, "/api/users/{id}", n.routes["GET"].path)
+	v, ok := params.get("id")
+	assert.True(t, ok)
+	assert.Equal(t, "42", v)
+
+	n, params = r.lookup("/static/css/main.css")
+	assert.Equal(t, "/static/*filepath", n.routes["GET"].path)
+	v, _ = params.get("filepath")
+	assert.Equal(t, "css/main.css", v)
+
+	n, _ = r.lookup("/api/users/42/posts")
+	assert.Nil(t, n)
+}
+
+func TestBindPathFields(t *testing.T) {
+	type req struct {
+		ID   int64  `json:"id" path:"id"`
+		Name string `json:"name"`
+	}
+	fields := fieldsByTag(reflect.TypeOf(&req{}), pathTag)
+	assert.Len(t, fields, 1)
+
+	v := &req{}
+	params := pathParams{{key: "id", value: "42"}}
+	assert.Nil(t, fields.bind(v, params.values))
+	assert.Equal(t, int64(42), v.ID)
+
+	params = pathParams{{key: "id", value: "abc"}}
+	assert.NotNil(t, fields.bind(v, params.values))
+
+	assert.Equal(t, "/static/{filepath}", openapiPath("/static/*filepath"))
+	assert.Equal(t, "GET_api_users_id", operationID("GET", "/api/users/{id}"))
+}
+
+type pooledSlice struct {
+	Items []int
+}
+
+func (p *pooledSlice) Reset() {
+	p.Items = p.Items[:0]
+}
+
+func TestArgsPool(t *testing.T) {
+	type plain struct {
+		Name string
+	}
+	rt := &route{factory: func() (interface{}, interface{}) {
+		return &plain{}, &pooledSlice{}
+	}}
+	rt.pool = newArgsPool(rt.factory)
+
+	req, rsp := rt.newArgs()
+	req.(*plain).Name = "bob"
+	rsp.(*pooledSlice).Items = append(rsp.(*pooledSlice).Items, 1, 2)
+	rt.release(req, rsp)
+
+	assert.Equal(t, "", req.(*plain).Name)
+	assert.Len(t, rsp.(*pooledSlice).Items, 0)
+	assert.Equal(t, 2, cap(rsp.(*pooledSlice).Items))
+}
+
+func TestRouterMethods(t *testing.T) {
+	r := newRouter()
+	assert.Nil(t, r.add(&route{method: "GET", path: "/items"}))
+	assert.Nil(t, r.add(&route{method: "PATCH", path: "/items"}))
+	assert.Nil(t, r.add(&route{method: "GET", path: "/ws", isWebsocket: true}))
+
+	n, _ := r.lookup("/items")
+	assert.Equal(t, "GET, HEAD, OPTIONS, PATCH", n.allow)
+	assert.Equal(t, n.routes["GET"], n.lookup("HEAD"))
+	assert.Nil(t, n.lookup("POST"))
+
+	n, _ = r.lookup("/ws")
+	assert.Equal(t, "GET, OPTIONS", n.allow)
+	assert.Nil(t, n.lookup("HEAD"))
+}
+
+func TestRouterCaseAndSlash(t *testing.T) {
+	r := newRouter()
+	slash := &route{method: "GET", path: "/docs/"}
+	assert.Nil(t, r.add(slash))
+	assert.True(t, slash.trailingSlash)
+
+	n, _ := r.lookup("/Docs")
+	assert.Nil(t, n)
+
+	r.caseInsensitive = true
+	n, _ = r.lookup("/Docs")
+	assert.Equal(t, slash, n.routes["GET"])
+}
+
+func TestPathMapping(t *testing.T) {
+	pm := newPathMapper(map[string]string{
+		"/hello":    "/api/hello",
+		"/v1/*":     "/api/*",
+		"/v1/old/*": "/api/new/*",
+	})
+	assert.Equal(t, "/api/hello", pm.rewrite("/hello"))
+	assert.Equal(t, "/api/users/1", pm.rewrite("/v1/users/1"))
+	assert.Equal(t, "/api/new/x", pm.rewrite("/v1/old/x"))
+	assert.Equal(t, "/api", pm.rewrite("/v1"))
+	assert.Equal(t, "/other", pm.rewrite("/other"))
+	assert.Equal(t, []string{"/hello", "/v1/hello"}, pm.aliases("/api/hello"))
+
+	var empty *pathMapper
+	assert.Equal(t, "/hello", empty.rewrite("/hello"))
+}
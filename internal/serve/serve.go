@@ -2,51 +2,92 @@ package serve
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
+	"net"
+	"os"
+	"os/signal"
 	"reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/fasthttp/websocket"
-	"github.com/kelseyhightower/envconfig"
 	"github.com/ottstack/gofunc/pkg/ecode"
 	"github.com/ottstack/gofunc/pkg/middleware"
+	"github.com/ottstack/gofunc/pkg/reqctx"
 	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/reuseport"
 	"go.uber.org/automaxprocs/maxprocs"
 )
 
 var allowMethod = map[string]bool{
-	"GET":    true,
-	"POST":   true,
-	"DELETE": true,
-	"PUT":    true,
-	"STREAM": true,
+	"GET":     true,
+	"POST":    true,
+	"DELETE":  true,
+	"PUT":     true,
+	"PATCH":   true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"STREAM":  true,
+	"EVENTS":  true,
 }
 
-type Server struct {
-	methods       map[string]methodFactory
-	streamMethods map[string]bool
-	api           *openapi
-	middlewares   []middleware.Middleware
-	ctx           context.Context
-	cancelFunc    context.CancelFunc
-	addr          string
-	swaggerPath   string
-	pathMapping   map[string]string
-	apiContent    []byte
-
-	rawHandler map[string]func(*fasthttp.RequestCtx)
-
-	crossDomain bool
+// hasBody reports whether the request of method is decoded from body instead of query
+func hasBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
 }
 
-type serveConfig struct {
-	Addr        string
-	SwaggerPath string
+type Server struct {
+	router      *router
+	api         *openapi
+	middlewares []middleware.Middleware
+	// httpMiddlewares wrap every request before routing
+	httpMiddlewares []middleware.Middleware
+	httpHandler     atomic.Value // middleware.MethodFunc, dispatch wrapped by httpMiddlewares
+
+	mu          sync.Mutex
+	chainsBuilt bool
+	// ctx is the parent of request contexts, cancelled once draining is over
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	// streamCtx is the parent of stream contexts, cancelled when shutdown starts
+	streamCtx    context.Context
+	streamCancel context.CancelFunc
+
+	addr        string
+	swaggerPath string
+	pathMapping *pathMapper
+	codecs      *codecRegistry
+	apiContent  []byte
+
+	// optionsRoute serves OPTIONS requests to paths without such route
+	optionsRoute  *route
+	timeout       time.Duration
+	trailingSlash string
+
+	httpServer *fasthttp.Server
+	tlsConfig  *tls.Config
+	reusePort  bool
+	// bodyLimits is set once a route has its own body size limit
+	bodyLimits int32
+
+	compress        bool
+	compressMinSize int
+	drainTimeout    time.Duration
+	streams         int64
+	lns             []net.Listener
+	stopping        bool
+	stopped         chan struct{}
+	stopOnce        sync.Once
 }
 
-type methodFactory func() (middleware.MethodFunc, interface{}, interface{})
+type methodFactory func() (interface{}, interface{})
 type methodInfo struct {
 	method      interface{}
 	operationId string
@@ -55,40 +96,74 @@ type methodInfo struct {
 	summary string
 
 	httpMethod  string
+	call        middleware.MethodFunc
 	factory     methodFactory
 	reqType     reflect.Type
 	rspType     reflect.Type
 	path        string
 	isWebsocket bool
+	isEvents    bool
+	bindings    requestBindings
+	status      int
 }
 
-func NewServer() *Server {
-	cfg := &serveConfig{
-		Addr:        "127.0.0.1:9001",
-		SwaggerPath: "/",
+// NewServer creates a server configured by opts, environment variables take precedence
+func NewServer(opts ...Option) (*Server, error) {
+	cfg, err := newServeConfig(opts...)
+	if err != nil {
+		return nil, err
 	}
-	err := envconfig.Process("serve", cfg)
+	tlsConfig, err := newTLSConfig(cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
+	streamCtx, streamCancel := context.WithCancel(ctx)
 	sv := &Server{
-		swaggerPath:   cfg.SwaggerPath,
-		addr:          cfg.Addr,
-		ctx:           ctx,
-		cancelFunc:    cancelFunc,
-		methods:       make(map[string]methodFactory),
-		streamMethods: make(map[string]bool),
-		crossDomain:   false,
-		rawHandler:    make(map[string]func(*fasthttp.RequestCtx)),
+		swaggerPath: cfg.SwaggerPath,
+		addr:        cfg.Addr,
+		timeout:     cfg.Timeout,
+		ctx:         ctx,
+		cancelFunc:  cancelFunc,
+		router:      newRouter(),
+		codecs:      newCodecRegistry(),
+
+		streamCtx:    streamCtx,
+		streamCancel: streamCancel,
+
+		trailingSlash: cfg.TrailingSlash,
+		drainTimeout:  cfg.DrainTimeout,
+		tlsConfig:     tlsConfig,
+		reusePort:     cfg.ReusePort,
+
+		compress:        cfg.Compress,
+		compressMinSize: cfg.CompressMinSize,
+		stopped:         make(chan struct{}),
+	}
+	sv.router.caseInsensitive = cfg.CaseInsensitive
+	sv.optionsRoute = &route{method: "OPTIONS", call: func(ctx context.Context, req, rsp interface{}) error {
+		reqctx.RequestCtx(ctx).SetStatusCode(fasthttp.StatusNoContent)
+		return nil
+	}}
+	sv.httpServer = &fasthttp.Server{
+		Handler:            sv.serve,
+		HeaderReceived:     sv.requestConfig,
+		ErrorHandler:       readError,
+		Name:               cfg.Name,
+		ReadTimeout:        cfg.ReadTimeout,
+		WriteTimeout:       cfg.WriteTimeout,
+		IdleTimeout:        cfg.IdleTimeout,
+		MaxRequestBodySize: cfg.MaxRequestBodySize,
+		Concurrency:        cfg.Concurrency,
+		DisableKeepalive:   cfg.DisableKeepalive,
 	}
 	sv.api = newOpenapi(cfg.SwaggerPath)
 	sv.api.parseType("", reflect.TypeOf(&ecode.APIError{}))
-	return sv
+	return sv, nil
 }
 
-func (s *Server) Handle(method, path string, function interface{}, summary string, tag string) error {
+func (s *Server) Handle(method, path string, function interface{}, summary string, tag string, opts ...RouteOption) error {
 	if !strings.HasPrefix(path, "/") {
 		path = "/" + path
 	}
@@ -96,19 +171,28 @@ func (s *Server) Handle(method, path string, function interface{}, summary strin
 		return fmt.Errorf("http method %s is unsupported", method)
 	}
 	checkMethod := method
-	if method == "STREAM" {
+	if method == "STREAM" || method == "EVENTS" {
 		checkMethod = "GET"
 	}
-	methodPath := checkMethod + "_" + path
-	if _, ok := s.methods[methodPath]; ok {
-		return fmt.Errorf("%s %s already registered", method, path)
+	rt := &route{method: checkMethod, path: path}
+	o := &routeOptions{heartbeat: defaultHeartbeat}
+	if checkMethod == method {
+		// streams are long-lived, they only get a deadline through WithTimeout
+		o.timeout = s.timeout
 	}
-	if _, ok := s.rawHandler[methodPath]; ok {
-		return fmt.Errorf("%s %s already registered for http handler", method, path)
+	for _, opt := range opts {
+		opt(o)
+	}
+	rt.timeout = o.timeout
+	rt.status = o.status
+	rt.noCompress = o.noCompress
+	rt.maxBodySize = o.maxBodySize
+	if o.maxBodySize > 0 {
+		atomic.StoreInt32(&s.bodyLimits, 1)
 	}
 	if vv, ok := function.(func(*fasthttp.RequestCtx)); ok {
-		s.rawHandler[methodPath] = vv
-		return nil
+		rt.call = chain(o.middlewares, rawCall(vv))
+		return s.addRoute(rt)
 	}
 	info := &methodInfo{
 		httpMethod:  method,
@@ -116,47 +200,321 @@ func (s *Server) Handle(method, path string, function interface{}, summary strin
 		summary:     summary,
 		tags:        []string{tag},
 		method:      function,
-		operationId: method + strings.ReplaceAll(path, "/", "_"),
+		operationId: operationID(method, path),
+		status:      o.status,
+	}
+	if vv, ok := function.(*Typed); ok {
+		if err := parseTyped(info, vv); err != nil {
+			return err
+		}
+	} else if err := parseMethods(info); err != nil {
+		return err
 	}
-	if err := parseMethods(info); err != nil {
+	if err := info.bindings.checkPath(path); err != nil {
 		return err
 	}
 
-	if info.httpMethod == "STREAM" {
+	if info.httpMethod == "STREAM" || info.httpMethod == "EVENTS" {
 		info.httpMethod = "GET"
-		s.streamMethods[path] = true
 	}
-
-	s.methods[methodPath] = info.factory
+	rt.factory = info.factory
+	if o.pooled && !info.isWebsocket && !info.isEvents {
+		rt.pool = newArgsPool(rt.factory)
+	}
+	rt.call = chain(o.middlewares, info.call)
+	rt.isWebsocket = info.isWebsocket
+	rt.isEvents = info.isEvents
+	rt.heartbeat = o.heartbeat
+	rt.isDownload = info.rspType == downloadType
+	rt.bindings = info.bindings
+	if err := s.addRoute(rt); err != nil {
+		return err
+	}
 
 	s.api.addMethod(info)
 	return nil
 }
 
+func (s *Server) addRoute(rt *route) error {
+	if err := s.router.add(rt); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.chainsBuilt {
+		rt.handler.Store(s.routeHandler(rt))
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// routeHandler wraps typed handlers with the server middlewares, raw ones are left as is
+func (s *Server) routeHandler(rt *route) middleware.MethodFunc {
+	if rt.factory == nil {
+		return rt.call
+	}
+	return chain(s.middlewares, rt.call)
+}
+
+// Use adds a middleware wrapping typed handlers
 func (s *Server) Use(m middleware.Middleware) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.middlewares = append(s.middlewares, m)
+	if s.chainsBuilt {
+		s.buildChainsLocked()
+	}
 	return s
 }
 
+// UseHTTP adds a middleware wrapping every request before routing, with nil req and rsp.
+// It also covers raw http handlers, preflight requests and errors answered before
+// a handler runs such as 404 or 415, e.g. for CORS.
+func (s *Server) UseHTTP(m middleware.Middleware) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.httpMiddlewares = append(s.httpMiddlewares, m)
+	if s.chainsBuilt {
+		s.buildChainsLocked()
+	}
+	return s
+}
+
+// buildChains composes the server middlewares around every route once,
+// so that no closure is allocated per request
+func (s *Server) buildChains() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buildChainsLocked()
+}
+
+func (s *Server) buildChainsLocked() {
+	s.router.walk(func(rt *route) {
+		rt.handler.Store(s.routeHandler(rt))
+	})
+	s.optionsRoute.handler.Store(s.optionsRoute.call)
+	if len(s.httpMiddlewares) > 0 {
+		s.httpHandler.Store(chain(s.httpMiddlewares, func(ctx context.Context, req, rsp interface{}) error {
+			s.dispatch(ctx, reqctx.RequestCtx(ctx))
+			return nil
+		}))
+	}
+	s.chainsBuilt = true
+}
+
+// Serve listens on the configured address: "host:port", "unix:/path/to.sock",
+// or one SO_REUSEPORT listener per GOMAXPROCS in reuseport mode.
+// SIGTERM and SIGINT shut the server down.
 func (s *Server) Serve() error {
-	defer s.cancelFunc()
-	// maxprocs
+	s.setMaxProcs()
+	lns, err := s.listen()
+	if err != nil {
+		return err
+	}
+	return s.serveListeners(lns, true)
+}
+
+// ServeListener serves on ln, wrapped with TLS if configured.
+// Signals are left to the caller, which stops the server with Shutdown.
+func (s *Server) ServeListener(ln net.Listener) error {
+	s.setMaxProcs()
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+	return s.serveListeners([]net.Listener{ln}, false)
+}
+
+func (s *Server) setMaxProcs() {
 	maxprocs.Set(maxprocs.Logger(func(s string, args ...interface{}) {
 		log.Printf(s, args...)
 	}))
+}
 
-	showAddr := s.addr
-	addrInfo := strings.SplitN(s.addr, ":", 2)
-	if addrInfo[0] == "" || addrInfo[0] == "0" || addrInfo[0] == "0.0.0.0" {
-		showAddr = "localhost:" + addrInfo[1]
+// serveListeners serves on lns until Shutdown, or SIGTERM/SIGINT with handleSignals
+func (s *Server) serveListeners(lns []net.Listener, handleSignals bool) error {
+	defer s.cancelFunc()
+
+	showAddr := lns[0].Addr().String()
+	if host, port, err := net.SplitHostPort(showAddr); err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			showAddr = "localhost:" + port
+		}
+	}
+	scheme := "http://"
+	if s.tlsConfig != nil {
+		scheme = "https://"
 	}
-	log.Println("Serving API on http://" + showAddr + s.swaggerPath)
+	if lns[0].Addr().Network() == "unix" {
+		log.Println("Serving API on unix:" + showAddr + ", document at " + s.swaggerPath)
+	} else {
+		log.Println("Serving API on " + scheme + showAddr + s.swaggerPath)
+	}
+	s.api.addMediaTypes(s.codecs.types)
+	s.api.addAliases(s.pathMapping)
 	s.apiContent = s.api.getOpenAPIV3()
-	return fasthttp.ListenAndServe(s.addr, s.serve)
+	s.buildChains()
+
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		for _, ln := range lns {
+			ln.Close()
+		}
+		return nil
+	}
+	s.lns = append(s.lns, lns...)
+	s.mu.Unlock()
+
+	// a nil channel never receives
+	var sigCh chan os.Signal
+	if handleSignals {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+		defer signal.Stop(sigCh)
+	}
+
+	errCh := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			errCh <- s.httpServer.Serve(ln)
+		}(ln)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil || s.streamCtx.Err() == nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return err
+		}
+		// Shutdown was called, wait for it to drain
+		<-s.stopped
+		return nil
+	case sig := <-sigCh:
+		log.Printf("Received %v, draining for up to %v", sig, s.drainTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Println("Shutdown error: ", err.Error())
+		}
+		return nil
+	}
+}
+
+func (s *Server) listen() ([]net.Listener, error) {
+	var lns []net.Listener
+	switch {
+	case strings.HasPrefix(s.addr, "unix:"):
+		path := strings.TrimPrefix(s.addr, "unix:")
+		if err := removeSocket(path); err != nil {
+			return nil, err
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		lns = append(lns, ln)
+	case s.reusePort:
+		network := reusePortNetwork(s.addr)
+		for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+			ln, err := reuseport.Listen(network, s.addr)
+			if err != nil {
+				for _, l := range lns {
+					l.Close()
+				}
+				return nil, err
+			}
+			lns = append(lns, ln)
+		}
+	default:
+		ln, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	if s.tlsConfig != nil {
+		for i := range lns {
+			lns[i] = tls.NewListener(lns[i], s.tlsConfig)
+		}
+	}
+	return lns, nil
 }
 
-// serve serve as http handler
+// removeSocket removes the unix socket left at path by a previous run, other files are kept
+func removeSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a unix socket", path)
+	}
+	return os.Remove(path)
+}
+
+// reusePortNetwork selects tcp6 for IPv6 addresses, reuseport only supports tcp4 and tcp6
+func reusePortNetwork(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			return "tcp6"
+		}
+	}
+	return "tcp4"
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx is done.
+// Streams are asked to finish through their context, request contexts are only cancelled
+// once draining is over.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.stopOnce.Do(func() { close(s.stopped) })
+	defer s.cancelFunc()
+	s.mu.Lock()
+	s.stopping = true
+	lns := s.lns
+	s.mu.Unlock()
+
+	s.streamCancel()
+	err := s.httpServer.ShutdownWithContext(ctx)
+	// listeners fasthttp has not started serving yet
+	for _, ln := range lns {
+		ln.Close()
+	}
+
+	// hijacked websocket connections are not tracked by fasthttp
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&s.streams) > 0 {
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return err
+		case <-ticker.C:
+		}
+	}
+	return err
+}
+
+// serve serves as http handler through the http middlewares
 func (s *Server) serve(fastReq *fasthttp.RequestCtx) {
+	if h, _ := s.httpHandler.Load().(middleware.MethodFunc); h != nil {
+		if err := h(reqctx.NewContext(s.ctx, fastReq), nil, nil); err != nil {
+			writeErrResponse(fastReq, err)
+		}
+		return
+	}
+	s.dispatch(s.ctx, fastReq)
+}
+
+// dispatch serves the API document or the route of a request,
+// handler contexts derive from parent to keep the values of the http middlewares
+func (s *Server) dispatch(parent context.Context, fastReq *fasthttp.RequestCtx) {
 	// serve openapi
 	path := string(fastReq.Path())
 	method := strings.ToUpper(string(fastReq.Method()))
@@ -175,100 +533,354 @@ func (s *Server) serve(fastReq *fasthttp.RequestCtx) {
 		return
 	}
 
-	methodPath := method + "_" + path
-	hd, ok := s.rawHandler[methodPath]
-	if ok {
-		hd(fastReq)
+	// path to route
+	var rt *route
+	node, params := s.router.lookup(s.pathMapping.rewrite(path))
+	if node != nil {
+		rt = node.lookup(method)
+		if rt != nil && !s.checkTrailingSlash(fastReq, rt, method, path) {
+			return
+		}
+	}
+	if rt == nil && node != nil && method == "OPTIONS" {
+		// answer with Allow, http middlewares such as CORS handle preflight requests before
+		fastReq.Response.Header.Set("Allow", node.allow)
+		rt = s.optionsRoute
+	}
+	if rt == nil && node != nil {
+		fastReq.Response.Header.Set("Allow", node.allow)
+		writeRouteError(fastReq, 405, fmt.Sprintf("Method %s not allowed for %s, allowed: %s", method, path, node.allow))
+		return
+	}
+	if rt == nil {
+		writeRouteError(fastReq, 404, fmt.Sprintf("Request %s %s not found", method, path))
+		return
+	}
+	for _, p := range params {
+		fastReq.SetUserValue(p.key, p.value)
+	}
+	if rt.factory == nil {
+		s.serveRaw(parent, fastReq, rt)
 		return
 	}
 
-	if s.crossDomain {
-		referer := string(fastReq.Referer())
-		if u, _ := url.Parse(referer); u != nil {
-			fastReq.Response.Header.Set("Access-Control-Allow-Origin", fmt.Sprintf("%s://%s", u.Scheme, u.Host))
-		} else {
-			fastReq.Response.Header.Set("Access-Control-Allow-Origin", "*")
-		}
-		fastReq.Response.Header.Set("Access-Control-Allow-Credentials", "true")
-		fastReq.Response.Header.Set("Access-Control-Allow-Headers", "authorization, origin, content-type, accept")
-		fastReq.Response.Header.Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS,DELETE,PUT")
-		if method == "OPTIONS" {
+	isWebsocket := rt.isWebsocket
+	var reqBody []byte
+	var decoder func([]byte, interface{}) error
+	var rspType string
+	var rspCodec Codec
+	// downloads and event streams set their own content type
+	if !isWebsocket && !rt.isDownload && !rt.isEvents {
+		if rspType, rspCodec = s.codecs.responseCodec(fastReq.Request.Header.Peek("Accept")); rspCodec == nil {
+			writeRouteError(fastReq, 406, "Not acceptable, supported media types: "+strings.Join(s.codecs.types, ", "))
 			return
 		}
 	}
-
-	// path to func
-	factory, ok := s.methods[methodPath]
-	if !ok {
-		writeErrResponse(fastReq, &ecode.APIError{Code: 404, Message: fmt.Sprintf("Request %s %s not found", method, path)})
-		return
+	if !isWebsocket {
+		if hasBody(method) {
+			var cleanup func()
+			var ok bool
+			if reqBody, decoder, cleanup, ok = s.bodyDecoder(fastReq, rt); !ok {
+				return
+			}
+			if cleanup != nil {
+				defer cleanup()
+			}
+		} else if query := fastReq.URI().QueryString(); len(query) > 0 {
+			reqBody = query
+			decoder = queryDecoder
+		}
 	}
-	realMethod, req, rsp := factory()
 
-	var reqBody []byte
-	decoder := jsonDecoder
-	isWebsocket := s.streamMethods[path]
+	realMethod := rt.handler.Load().(middleware.MethodFunc)
+	req, rsp := rt.newArgs()
 	var stream *streamImp
+	if rt.isEvents {
+		rsp.(*eventStream).prepare(fastReq, rt.heartbeat, &s.streams)
+	}
 
 	doCallFunc := func() {
-		if len(reqBody) > 0 {
+		defer rt.release(req, rsp)
+		if decoder != nil {
 			if err := decoder(reqBody, req); err != nil {
 				writeErrResponse(fastReq, &ecode.APIError{Code: 400, Message: "Decode request body failed: " + err.Error()})
 				return
 			}
 		}
+		if !isWebsocket {
+			if err := rt.bindings.bind(fastReq, req, params); err != nil {
+				writeErrResponse(fastReq, &ecode.APIError{Code: 400, Message: err.Error()})
+				return
+			}
+		}
 
-		ctx := context.Background()
-
-		// Middleware
-		for i := range s.middlewares {
-			mware := s.middlewares[len(s.middlewares)-i-1]
-			realMethod = func(mm middleware.MethodFunc) middleware.MethodFunc {
-				return func(ctx context.Context, req, rsp interface{}) error {
-					return mware(ctx, fastReq, mm, req, rsp)
-				}
-			}(realMethod)
+		ctx, cancel := s.requestContext(parent, fastReq, rt)
+		if events, ok := rsp.(*eventStream); ok {
+			events.cancel = cancel
+			defer events.release()
+		} else {
+			defer cancel()
+		}
+		if !isWebsocket && !rt.isEvents {
+			defer watchConn(fastReq.Conn(), cancel)()
 		}
+		if stream != nil {
+			stream.cancel = cancel
+		}
+
 		err := realMethod(ctx, req, rsp)
-		if isWebsocket {
+		if isWebsocket || (rt.isEvents && err == nil) {
 			return
 		}
 		if err != nil {
 			writeErrResponse(fastReq, err)
 			return
 		}
+		if noBody(fastReq.Response.StatusCode()) {
+			if rt.isDownload {
+				rsp.(*Download).close()
+			}
+			return
+		}
+		if rt.isDownload {
+			writeDownload(fastReq, rsp.(*Download))
+			return
+		}
 
-		fastReq.Response.Header.Set("Content-Type", "application/json")
-		reqBody, err = encoder(rsp)
+		reqBody, err = rspCodec.Encode(rsp)
 		if err != nil {
 			writeErrResponse(fastReq, fmt.Errorf("marshal rsp error: %v", err))
 			return
 		}
-		fastReq.Write(reqBody)
+		fastReq.Response.Header.Set("Content-Type", rspType)
+		s.writeBody(fastReq, rt, reqBody)
 	}
 
+	if rt.status != 0 && !isWebsocket && !rt.isEvents {
+		fastReq.Response.SetStatusCode(rt.status)
+	}
 	if isWebsocket {
+		// typed messages use the codec of Accept, browsers cannot set it and get the default one
+		mediaType, codec := s.codecs.responseCodec(fastReq.Request.Header.Peek("Accept"))
+		if codec == nil {
+			mediaType = s.codecs.types[0]
+			codec = s.codecs.codecs[mediaType]
+		}
 		err := upgrader.Upgrade(fastReq, func(conn *websocket.Conn) {
+			atomic.AddInt64(&s.streams, 1)
+			defer atomic.AddInt64(&s.streams, -1)
 			stream = rsp.(*streamImp)
 			stream.conn = conn
+			stream.codec = codec
+			stream.binary = !isTextMediaType(mediaType)
 			defer stream.close()
+			done := make(chan struct{})
+			defer close(done)
+			go stream.goAway(s.streamCtx, done)
 			doCallFunc()
 		})
 		if err != nil {
 			log.Println("Upgrade websocket error: ", err.Error())
 		}
 		return
-	} else if method == "POST" || method == "PUT" {
-		reqBody = fastReq.PostBody()
-	} else {
-		reqBody = fastReq.URI().QueryString()
-		decoder = queryDecoder
 	}
 	doCallFunc()
 }
 
+// requestConfig applies the body size limit of the route before fasthttp reads the body,
+// so larger requests are refused by their Content-Length without being buffered
+func (s *Server) requestConfig(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	if atomic.LoadInt32(&s.bodyLimits) == 0 {
+		return fasthttp.RequestConfig{}
+	}
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+	if err := uri.Parse(nil, header.RequestURI()); err != nil {
+		return fasthttp.RequestConfig{}
+	}
+	node, _ := s.router.lookup(s.pathMapping.rewrite(string(uri.Path())))
+	if node == nil {
+		return fasthttp.RequestConfig{}
+	}
+	rt := node.lookup(strings.ToUpper(string(header.Method())))
+	if rt == nil || rt.maxBodySize <= 0 {
+		return fasthttp.RequestConfig{}
+	}
+	limit := s.httpServer.MaxRequestBodySize
+	if limit <= 0 || limit > rt.maxBodySize {
+		limit = rt.maxBodySize
+	}
+	return fasthttp.RequestConfig{MaxRequestBodySize: limit}
+}
+
+// readError answers requests with a body over the limit as an API error,
+// other errors fasthttp failed to read a request with get the answer of its default handler
+func readError(fastReq *fasthttp.RequestCtx, err error) {
+	var smallBuffer *fasthttp.ErrSmallBuffer
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, fasthttp.ErrBodyTooLarge):
+		writeRouteError(fastReq, 413, "Request body too large")
+	case errors.As(err, &smallBuffer):
+		fastReq.Error("Too big request header", fasthttp.StatusRequestHeaderFieldsTooLarge)
+	case errors.As(err, &opErr) && opErr.Timeout():
+		fastReq.Error("Request timeout", fasthttp.StatusRequestTimeout)
+	default:
+		fastReq.Error("Error when parsing request", fasthttp.StatusBadRequest)
+	}
+}
+
+// bodyDecoder reads the request body and selects its decoder by Content-Type, cleanup removes
+// the temporary files of uploads. It returns false if the request has been answered.
+func (s *Server) bodyDecoder(fastReq *fasthttp.RequestCtx, rt *route) ([]byte, func([]byte, interface{}) error, func(), bool) {
+	contentType := fastReq.Request.Header.ContentType()
+	if isMultipart(contentType) && len(fastReq.Request.Header.ContentEncoding()) == 0 {
+		// fasthttp parses the form while reading the body, spilling large files to temporary files
+		form, err := fastReq.MultipartForm()
+		if err != nil {
+			writeRouteError(fastReq, 400, "Decode multipart body failed: "+err.Error())
+			return nil, nil, nil, false
+		}
+		decoder := func(_ []byte, v interface{}) error {
+			return bindMultipart(form, rt.bindings.files, v)
+		}
+		return nil, decoder, fastReq.Request.RemoveMultipartFormFiles, true
+	}
+	body, ok := s.readBody(fastReq)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	if rt.maxBodySize > 0 && len(body) > rt.maxBodySize {
+		writeRouteError(fastReq, 413, fmt.Sprintf("Request body larger than %d bytes", rt.maxBodySize))
+		return nil, nil, nil, false
+	}
+	if isMultipart(contentType) {
+		form, err := readMultipart(body, contentType)
+		if err != nil {
+			writeRouteError(fastReq, 400, "Decode multipart body failed: "+err.Error())
+			return nil, nil, nil, false
+		}
+		decoder := func(_ []byte, v interface{}) error {
+			return bindMultipart(form, rt.bindings.files, v)
+		}
+		return body, decoder, func() { form.RemoveAll() }, true
+	}
+	codec := s.codecs.requestCodec(contentType)
+	if codec == nil && len(body) > 0 {
+		writeRouteError(fastReq, 415, fmt.Sprintf("Unsupported media type %s, supported: %s, %s",
+			contentType, strings.Join(s.codecs.types, ", "), mediaTypeMultipart))
+		return nil, nil, nil, false
+	}
+	if len(body) == 0 {
+		return body, nil, nil, true
+	}
+	return body, codec.Decode, nil, true
+}
+
+// checkTrailingSlash applies the trailing slash mode when path and the route pattern disagree,
+// it returns false if the request has been answered
+func (s *Server) checkTrailingSlash(fastReq *fasthttp.RequestCtx, rt *route, method, path string) bool {
+	if rt.catchAll || s.trailingSlash == TrailingSlashTolerate {
+		return true
+	}
+	hasSlash := len(path) > 1 && strings.HasSuffix(path, "/")
+	if hasSlash == rt.trailingSlash {
+		return true
+	}
+	if s.trailingSlash == TrailingSlashStrict {
+		writeRouteError(fastReq, 404, fmt.Sprintf("Request %s %s not found", method, path))
+		return false
+	}
+	target := strings.TrimRight(path, "/")
+	if rt.trailingSlash {
+		target += "/"
+	}
+	if target == "" {
+		target = "/"
+	}
+	if query := fastReq.URI().QueryString(); len(query) > 0 {
+		target += "?" + string(query)
+	}
+	code := fasthttp.StatusPermanentRedirect
+	if method == "GET" || method == "HEAD" {
+		code = fasthttp.StatusMovedPermanently
+	}
+	fastReq.Redirect(target, code)
+	return false
+}
+
+// serveRaw runs raw http handlers, they are not wrapped by the server middlewares
+func (s *Server) serveRaw(parent context.Context, fastReq *fasthttp.RequestCtx, rt *route) {
+	ctx, cancel := s.requestContext(parent, fastReq, rt)
+	defer cancel()
+	defer watchConn(fastReq.Conn(), cancel)()
+	if err := rt.handler.Load().(middleware.MethodFunc)(ctx, nil, nil); err != nil {
+		writeErrResponse(fastReq, err)
+	}
+}
+
+func rawCall(raw func(*fasthttp.RequestCtx)) middleware.MethodFunc {
+	return func(ctx context.Context, req, rsp interface{}) error {
+		raw(reqctx.RequestCtx(ctx))
+		return nil
+	}
+}
+
+// chain wraps method with middlewares, the first one being the outermost
+func chain(mws []middleware.Middleware, method middleware.MethodFunc) middleware.MethodFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		mw, next := mws[i], method
+		method = func(ctx context.Context, req, rsp interface{}) error {
+			return mw(ctx, reqctx.RequestCtx(ctx), next, req, rsp)
+		}
+	}
+	return method
+}
+
+// noBody reports whether a response with status code must not carry the encoded rsp,
+// such as 204 No Content or a redirect
+func noBody(code int) bool {
+	return code < 200 || code == 204 || (code >= 300 && code < 400)
+}
+
+// requestContext derives the handler context from parent, which derives from the server context.
+// It is cancelled when the handler returns, the route timeout expires, the server stops
+// or the client disconnects: unary handlers through a watcher of the connection,
+// streams once a read or write on it fails. Streams also end once shutdown starts.
+func (s *Server) requestContext(parent context.Context, fastReq *fasthttp.RequestCtx, rt *route) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if rt.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, rt.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	if rt.isWebsocket || rt.isEvents {
+		go func() {
+			select {
+			case <-s.streamCtx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return reqctx.NewContext(ctx, fastReq), cancel
+}
+
+// PathMapping maps external paths onto registered routes before lookup.
+// Keys are external paths, a "/*" suffix on both sides rewrites a prefix.
 func (s *Server) PathMapping(m map[string]string) *Server {
-	s.pathMapping = m
+	s.pathMapping = newPathMapper(m)
+	return s
+}
+
+// RegisterCodec adds or replaces the codec of mediaType, it must be called before serving.
+// Built-in codecs are application/json (the default), application/x-www-form-urlencoded,
+// application/xml and application/msgpack.
+func (s *Server) RegisterCodec(mediaType string, c Codec) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codecs.register(mediaType, c)
 	return s
 }
 
@@ -297,6 +909,14 @@ func parseMethods(m *methodInfo) error {
 			return fmt.Errorf("the type of third argment in %s should be websocket.SendStream", m.path)
 		}
 		m.isWebsocket = true
+	} else if m.httpMethod == "EVENTS" {
+		if req.Kind() != reflect.Ptr || req.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("the type of second argment in %s should be pointer to struct", m.path)
+		}
+		if rsp != sendEventsType {
+			return fmt.Errorf("the type of third argment in %s should be sse.SendStream", m.path)
+		}
+		m.isEvents = true
 	} else {
 		if req.Kind() != reflect.Ptr || req.Elem().Kind() != reflect.Struct {
 			return fmt.Errorf("the type of second argment in %s should be pointer to struct", m.path)
@@ -327,23 +947,40 @@ func parseMethods(m *methodInfo) error {
 		return nil
 	}
 
-	m.factory = func() (middleware.MethodFunc, interface{}, interface{}) {
+	m.call = callFunc
+	if m.isEvents {
+		// the handler runs once the middlewares have returned and the stream is open
+		m.call = func(ctx context.Context, req, rsp interface{}) error {
+			return rsp.(*eventStream).start(ctx, func(ctx context.Context) error {
+				return callFunc(ctx, req, rsp)
+			})
+		}
+	}
+	m.factory = func() (interface{}, interface{}) {
 		var rspVal, reqVal interface{}
 		if m.isWebsocket {
 			reqVal = &streamImp{}
 			rspVal = reqVal
+		} else if m.isEvents {
+			reqVal = reflect.New(req.Elem()).Interface()
+			rspVal = &eventStream{}
 		} else {
 			reqVal = reflect.New(req.Elem()).Interface()
 			rspVal = reflect.New(rsp.Elem()).Interface()
 		}
-		return callFunc, reqVal, rspVal
+		return reqVal, rspVal
 	}
 	if m.isWebsocket {
 		m.reqType = req
 		m.rspType = rsp
+	} else if m.isEvents {
+		m.reqType = req.Elem()
+		m.rspType = rsp
+		m.bindings = newRequestBindings(m.reqType)
 	} else {
 		m.reqType = req.Elem()
 		m.rspType = rsp.Elem()
+		m.bindings = newRequestBindings(m.reqType)
 	}
 	return nil
 }
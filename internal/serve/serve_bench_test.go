@@ -0,0 +1,146 @@
+package serve
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/fasthttp/websocket"
+	"github.com/ottstack/gofunc/pkg/middleware"
+	gows "github.com/ottstack/gofunc/pkg/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+type benchRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type benchResponse struct {
+	Reply string `json:"reply"`
+}
+
+func benchHello(ctx context.Context, req *benchRequest, rsp *benchResponse) error {
+	rsp.Reply = req.Name
+	return nil
+}
+
+func benchEcho(ctx context.Context, req gows.RecvStream, rsp gows.SendStream) error {
+	for {
+		msg, err := req.Recv()
+		if err != nil {
+			return err
+		}
+		if err := rsp.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func newBenchServer(b *testing.B) *Server {
+	s, err := NewServer(IgnoreEnv())
+	if err != nil {
+		b.Fatal(err)
+	}
+	s.Use(middleware.Recover).Use(middleware.Validator)
+	if err := s.Handle("GET", "/hello", benchHello, "benchHello", "bench"); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.Handle("POST", "/hello", benchHello, "benchHello", "bench"); err != nil {
+		b.Fatal(err)
+	}
+	typed := &Typed{
+		Call: func(ctx context.Context, req, rsp interface{}) error {
+			return benchHello(ctx, req.(*benchRequest), rsp.(*benchResponse))
+		},
+		New: func() (interface{}, interface{}) {
+			return &benchRequest{}, &benchResponse{}
+		},
+		ReqType: reflect.TypeOf(benchRequest{}),
+		RspType: reflect.TypeOf(benchResponse{}),
+	}
+	if err := s.Handle("GET", "/typed", typed, "benchHello", "bench"); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.Handle("GET", "/pooled", typed, "benchHello", "bench", WithPool()); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.Handle("GET", "/raw", func(fastReq *fasthttp.RequestCtx) {
+		fastReq.WriteString("raw")
+	}, "", ""); err != nil {
+		b.Fatal(err)
+	}
+	if err := s.Handle("STREAM", "/echo", benchEcho, "benchEcho", "bench"); err != nil {
+		b.Fatal(err)
+	}
+	s.buildChains()
+	return s
+}
+
+func benchServe(b *testing.B, s *Server, method, uri string, body []byte) {
+	fastReq := &fasthttp.RequestCtx{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fastReq.Request.Reset()
+		fastReq.Response.Reset()
+		fastReq.Request.Header.SetMethod(method)
+		fastReq.Request.SetRequestURI(uri)
+		if body != nil {
+			fastReq.Request.SetBody(body)
+		}
+		s.serve(fastReq)
+		if fastReq.Response.StatusCode() != 200 {
+			b.Fatalf("unexpected status %d: %s", fastReq.Response.StatusCode(), fastReq.Response.Body())
+		}
+	}
+}
+
+func BenchmarkTypedGet(b *testing.B) {
+	benchServe(b, newBenchServer(b), "GET", "/hello?name=bob", nil)
+}
+
+func BenchmarkGenericGet(b *testing.B) {
+	benchServe(b, newBenchServer(b), "GET", "/typed?name=bob", nil)
+}
+
+func BenchmarkPooledGet(b *testing.B) {
+	benchServe(b, newBenchServer(b), "GET", "/pooled?name=bob", nil)
+}
+
+func BenchmarkTypedPost(b *testing.B) {
+	benchServe(b, newBenchServer(b), "POST", "/hello", []byte(`{"name":"bob"}`))
+}
+
+func BenchmarkRawHandler(b *testing.B) {
+	benchServe(b, newBenchServer(b), "GET", "/raw", nil)
+}
+
+func BenchmarkStreamMessage(b *testing.B) {
+	s := newBenchServer(b)
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go fasthttp.Serve(ln, s.serve)
+
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		return ln.Dial()
+	}}
+	conn, _, err := dialer.Dial("ws://bench/echo", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	msg := []byte("hello")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := conn.ReadMessage(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
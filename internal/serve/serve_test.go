@@ -0,0 +1,610 @@
+package serve
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fasthttp/websocket"
+	json "github.com/goccy/go-json"
+	"github.com/ottstack/gofunc/pkg/middleware"
+	"github.com/ottstack/gofunc/pkg/reqctx"
+	gows "github.com/ottstack/gofunc/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type emptyRequest struct{}
+
+type emptyResponse struct{}
+
+// serveRequest runs a request with header key value pairs through s without a listener
+func serveRequest(s *Server, method, uri, body string, header ...string) *fasthttp.Response {
+	s.buildChains()
+	fastReq := &fasthttp.RequestCtx{}
+	fastReq.Request.Header.SetMethod(method)
+	fastReq.Request.SetRequestURI(uri)
+	if body != "" {
+		fastReq.Request.Header.SetContentType("application/json")
+		fastReq.Request.SetBodyString(body)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		fastReq.Request.Header.Set(header[i], header[i+1])
+	}
+	s.serve(fastReq)
+	return &fastReq.Response
+}
+
+// newTCPServer serves s on a loopback listener, disconnects are not visible on in-memory ones
+func newTCPServer(t *testing.T, s *Server) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeListener(ln)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return ln.Addr().String()
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	unary := make(chan error, 1)
+	require.NoError(t, s.Handle("GET", "/wait", func(ctx context.Context, req *emptyRequest, rsp *emptyResponse) error {
+		select {
+		case <-ctx.Done():
+			unary <- ctx.Err()
+		case <-time.After(5 * time.Second):
+			unary <- nil
+		}
+		return nil
+	}, "wait", "test"))
+	sendOnly := make(chan error, 1)
+	require.NoError(t, s.Handle("STREAM", "/ticks", func(ctx context.Context, req gows.RecvStream, rsp gows.SendStream) error {
+		for ctx.Err() == nil {
+			if err := rsp.Send([]byte("tick")); err != nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		sendOnly <- ctx.Err()
+		return nil
+	}, "ticks", "test"))
+	addr := newTCPServer(t, s)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET /wait HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-unary:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("unary handler not cancelled")
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ticks", nil)
+	require.NoError(t, err)
+	_, _, err = ws.ReadMessage()
+	require.NoError(t, err)
+	ws.UnderlyingConn().Close()
+	select {
+	case err := <-sendOnly:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("send-only stream not cancelled")
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	started := make(chan struct{}, 1)
+	drained := make(chan error, 1)
+	require.NoError(t, s.Handle("GET", "/slow", func(ctx context.Context, req *emptyRequest, rsp *emptyResponse) error {
+		started <- struct{}{}
+		time.Sleep(100 * time.Millisecond)
+		drained <- ctx.Err()
+		return nil
+	}, "slow", "test"))
+	streamDone := make(chan error, 1)
+	require.NoError(t, s.Handle("STREAM", "/stream", func(ctx context.Context, req gows.RecvStream, rsp gows.SendStream) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		streamDone <- ctx.Err()
+		return nil
+	}, "stream", "test"))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.ServeListener(ln) }()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/stream", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	<-started
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	// the unary request finishes with a live context, the stream is asked to stop
+	assert.NoError(t, <-drained)
+	assert.Equal(t, context.Canceled, <-streamDone)
+	assert.NoError(t, <-serveErr)
+	buf := make([]byte, 12)
+	_, err = conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200", string(buf))
+}
+
+func TestShutdownExpired(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	require.NoError(t, s.Handle("GET", "/block", func(ctx context.Context, req *emptyRequest, rsp *emptyResponse) error {
+		close(started)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return nil
+	}, "block", "test"))
+	addr := newTCPServer(t, s)
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /block HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	assert.Equal(t, context.Canceled, <-cancelled)
+}
+
+func TestShutdownBeforeServe(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	assert.NoError(t, s.Shutdown(context.Background()))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- s.ServeListener(ln) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve after Shutdown did not return")
+	}
+	_, err = net.Dial("tcp", ln.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestShutdownDuringServe(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		s, err := NewServer(IgnoreEnv())
+		require.NoError(t, err)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		done := make(chan error, 1)
+		go func() { done <- s.ServeListener(ln) }()
+		assert.NoError(t, s.Shutdown(context.Background()))
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Serve did not return after Shutdown")
+		}
+	}
+}
+
+func TestServeSignal(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	s, err := NewServer(IgnoreEnv(), WithAddr(addr), WithDrainTimeout(time.Second))
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve() }()
+	// a served request means the signal handler is installed
+	require.Eventually(t, func() bool {
+		code, _, err := fasthttp.Get(nil, "http://"+addr+"/missing")
+		return err == nil && code == 404
+	}, time.Second, 10*time.Millisecond)
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGTERM))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Serve did not return on SIGTERM")
+	}
+}
+
+func TestServeListenerIgnoresSignals(t *testing.T) {
+	// the test takes the signal in place of the default handler
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	addr := newTCPServer(t, s)
+	code, _, err := fasthttp.Get(nil, "http://"+addr+"/missing")
+	require.NoError(t, err)
+	require.Equal(t, 404, code)
+
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGTERM))
+	<-sigCh
+	time.Sleep(50 * time.Millisecond)
+	code, _, err = fasthttp.Get(nil, "http://"+addr+"/missing")
+	require.NoError(t, err)
+	assert.Equal(t, 404, code)
+}
+
+type itemResponse struct {
+	ID string `json:"id"`
+}
+
+func TestStatus(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	create := func(ctx context.Context, req *emptyRequest, rsp *itemResponse) error {
+		rsp.ID = "1"
+		if reqctx.Header(ctx, "X-Async") != "" {
+			reqctx.SetStatus(ctx, 202)
+		}
+		return nil
+	}
+	remove := func(ctx context.Context, req *emptyRequest, rsp *itemResponse) error {
+		rsp.ID = "1"
+		return nil
+	}
+	require.NoError(t, s.Handle("POST", "/items", create, "create", "test", WithStatus(201)))
+	require.NoError(t, s.Handle("DELETE", "/items", remove, "remove", "test", WithStatus(204)))
+
+	rsp := serveRequest(s, "POST", "/items", "{}")
+	assert.Equal(t, 201, rsp.StatusCode())
+	assert.JSONEq(t, `{"id":"1"}`, string(rsp.Body()))
+	rsp = serveRequest(s, "DELETE", "/items", "")
+	assert.Equal(t, 204, rsp.StatusCode())
+	assert.Empty(t, rsp.Body())
+
+	rsp = serveRequest(s, "POST", "/items", "{}", "X-Async", "1")
+	assert.Equal(t, 202, rsp.StatusCode())
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]struct {
+				Content map[string]interface{} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(s.api.getOpenAPIV3(), &doc))
+	post := doc.Paths["/items"]["post"].Responses
+	assert.Contains(t, post, "201")
+	assert.NotContains(t, post, "200")
+	assert.Contains(t, post["201"].Content, "application/json")
+	del := doc.Paths["/items"]["delete"].Responses
+	assert.Contains(t, del, "204")
+	assert.Empty(t, del["204"].Content)
+}
+
+func TestHTTPMiddlewares(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	var typedCalls int
+	s.Use(func(ctx context.Context, fastReq *fasthttp.RequestCtx, method middleware.MethodFunc, req, rsp interface{}) error {
+		assert.NotNil(t, req)
+		assert.NotNil(t, rsp)
+		typedCalls++
+		return method(ctx, req, rsp)
+	})
+	s.UseHTTP(middleware.CORS(middleware.CORSConfig{AllowOrigins: []string{"https://app.example.com"}}))
+	require.NoError(t, s.Handle("POST", "/items", func(ctx context.Context, req *emptyRequest, rsp *itemResponse) error {
+		return nil
+	}, "create", "test", WithMaxBodySize(16)))
+	require.NoError(t, s.Handle("GET", "/raw", func(fastReq *fasthttp.RequestCtx) {
+		fastReq.WriteString("raw")
+	}, "", ""))
+	origin := []string{"Origin", "https://app.example.com"}
+	allowed := func(rsp *fasthttp.Response) string {
+		return string(rsp.Header.Peek("Access-Control-Allow-Origin"))
+	}
+
+	rsp := serveRequest(s, "GET", "/raw", "", origin...)
+	assert.Equal(t, "raw", string(rsp.Body()))
+	assert.Equal(t, "https://app.example.com", allowed(rsp))
+	assert.Equal(t, 0, typedCalls)
+
+	rsp = serveRequest(s, "POST", "/items", "{}", origin...)
+	assert.Equal(t, 200, rsp.StatusCode())
+	assert.Equal(t, "https://app.example.com", allowed(rsp))
+	assert.Equal(t, 1, typedCalls)
+
+	rsp = serveRequest(s, "OPTIONS", "/items", "", "Origin", "https://app.example.com", "Access-Control-Request-Method", "POST")
+	assert.Equal(t, 204, rsp.StatusCode())
+	assert.NotEmpty(t, rsp.Header.Peek("Access-Control-Allow-Methods"))
+
+	// errors answered before the handler runs
+	for _, c := range []struct {
+		method, path, body string
+		header             []string
+		code               int
+	}{
+		{"GET", "/missing", "", origin, 404},
+		{"DELETE", "/items", "", origin, 405},
+		{"POST", "/items", "{}", append([]string{"Accept", "text/html"}, origin...), 406},
+		{"POST", "/items", "{", origin, 400},
+		{"POST", "/items", `{"name":"too large"}`, origin, 413},
+		{"POST", "/items", "{}", append([]string{"Content-Encoding", "compress"}, origin...), 415},
+	} {
+		rsp = serveRequest(s, c.method, c.path, c.body, c.header...)
+		assert.Equal(t, c.code, rsp.StatusCode(), c.path)
+		assert.Equal(t, "https://app.example.com", allowed(rsp), c.code)
+	}
+	assert.Equal(t, 1, typedCalls)
+}
+
+type requestIDKey struct{}
+
+func TestHTTPMiddlewareContext(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	s.UseHTTP(func(ctx context.Context, fastReq *fasthttp.RequestCtx, method middleware.MethodFunc, req, rsp interface{}) error {
+		return method(context.WithValue(ctx, requestIDKey{}, "req-1"), req, rsp)
+	})
+	require.NoError(t, s.Handle("GET", "/id", func(ctx context.Context, req *emptyRequest, rsp *subjectResponse) error {
+		rsp.Subject, _ = ctx.Value(requestIDKey{}).(string)
+		return nil
+	}, "id", "test"))
+	var rawID interface{}
+	require.NoError(t, s.Handle("GET", "/raw", func(fastReq *fasthttp.RequestCtx) {}, "", "",
+		WithMiddlewares(func(ctx context.Context, fastReq *fasthttp.RequestCtx, method middleware.MethodFunc, req, rsp interface{}) error {
+			rawID = ctx.Value(requestIDKey{})
+			return method(ctx, req, rsp)
+		})))
+
+	rsp := serveRequest(s, "GET", "/id", "")
+	assert.JSONEq(t, `{"subject":"req-1"}`, string(rsp.Body()))
+	serveRequest(s, "GET", "/raw", "")
+	assert.Equal(t, "req-1", rawID)
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	s, err := NewServer(IgnoreEnv(), WithAddr("unix:"+path))
+	require.NoError(t, err)
+
+	// a socket left by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	lns, err := s.listen()
+	require.NoError(t, err)
+	go s.serveListeners(lns, false)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	c := &fasthttp.Client{Dial: func(addr string) (net.Conn, error) {
+		return net.Dial("unix", path)
+	}}
+	code, _, err := c.Get(nil, "http://unix/missing")
+	require.NoError(t, err)
+	assert.Equal(t, 404, code)
+
+	// other files are never removed
+	file := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(file, []byte("keep"), 0600))
+	s, err = NewServer(IgnoreEnv(), WithAddr("unix:"+file))
+	require.NoError(t, err)
+	_, err = s.listen()
+	assert.Error(t, err)
+	_, err = os.Stat(file)
+	assert.NoError(t, err)
+}
+
+func TestReusePort(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		free, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+		if err != nil {
+			t.Logf("skip %s: %v", host, err)
+			continue
+		}
+		addr := free.Addr().String()
+		free.Close()
+		s, err := NewServer(IgnoreEnv(), WithAddr(addr), WithReusePort(true))
+		require.NoError(t, err)
+		lns, err := s.listen()
+		require.NoError(t, err)
+		assert.Len(t, lns, runtime.GOMAXPROCS(0))
+		for _, ln := range lns {
+			assert.Equal(t, addr, ln.Addr().String())
+		}
+
+		go s.serveListeners(lns, false)
+		conn, err := net.Dial("tcp", lns[0].Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("GET /missing HTTP/1.1\r\nHost: test\r\n\r\n"))
+		require.NoError(t, err)
+		buf := make([]byte, 12)
+		_, err = conn.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1 404", string(buf))
+		conn.Close()
+		require.NoError(t, s.Shutdown(context.Background()))
+	}
+}
+
+type brokenResponse struct{}
+
+func (*brokenResponse) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("broken")
+}
+
+func TestErrorContentType(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	require.NoError(t, s.Handle("GET", "/broken", func(ctx context.Context, req *emptyRequest, rsp *brokenResponse) error {
+		return nil
+	}, "broken", "test"))
+
+	rsp := serveRequest(s, "GET", "/broken", "")
+	assert.Equal(t, 500, rsp.StatusCode())
+	assert.Equal(t, "application/json", string(rsp.Header.ContentType()))
+	assert.Contains(t, string(rsp.Body()), "marshal rsp error")
+
+	// errors are JSON whatever the negotiated codec
+	rsp = serveRequest(s, "GET", "/missing", "", "Accept", "application/msgpack")
+	assert.Equal(t, 404, rsp.StatusCode())
+	assert.Equal(t, "application/json", string(rsp.Header.ContentType()))
+	rsp = serveRequest(s, "POST", "/broken", "{}", "Accept", "application/msgpack")
+	assert.Equal(t, 405, rsp.StatusCode())
+	assert.Equal(t, "application/json", string(rsp.Header.ContentType()))
+}
+
+type uploadRequest struct {
+	File *File `json:"file"`
+}
+
+func TestUploadLimit(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	require.NoError(t, s.Handle("POST", "/upload", func(ctx context.Context, req *uploadRequest, rsp *emptyResponse) error {
+		return nil
+	}, "upload", "test", WithMaxBodySize(1024)))
+	addr := newTCPServer(t, s)
+
+	// refused by its Content-Length before the body is sent
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Type: multipart/form-data; boundary=x\r\nContent-Length: %d\r\n\r\n", 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	rsp := &fasthttp.Response{}
+	require.NoError(t, rsp.Read(bufio.NewReader(conn)))
+	assert.Equal(t, 413, rsp.StatusCode())
+	assert.Equal(t, "application/json", string(rsp.Header.ContentType()))
+}
+
+func TestReadErrors(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	addr := newTCPServer(t, s)
+	read := func(request string) *fasthttp.Response {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(request))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		rsp := &fasthttp.Response{}
+		require.NoError(t, rsp.Read(bufio.NewReader(conn)))
+		return rsp
+	}
+
+	// statuses of fasthttp are kept
+	rsp := read("GET /missing HTTP/1.1\r\nHost: localhost\r\nX-Large: " + strings.Repeat("x", 8192) + "\r\n\r\n")
+	assert.Equal(t, 431, rsp.StatusCode())
+	rsp = read("POST /missing HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	assert.Equal(t, 400, rsp.StatusCode())
+}
+
+type countMessage struct {
+	N int `json:"n"`
+}
+
+// EncodeMsgpack encodes the message as a bare integer, valid UTF-8 for small ones
+func (m *countMessage) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeInt(int64(m.N))
+}
+
+func TestStreamFrameType(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	require.NoError(t, s.Handle("STREAM", "/count", NewTypedStream(func(ctx context.Context, req gows.RecvOf[emptyRequest], rsp gows.SendOf[countMessage]) error {
+		return rsp.Send(&countMessage{N: 1})
+	}), "count", "test"))
+	addr := newTCPServer(t, s)
+
+	// the msgpack message is valid UTF-8 but still binary
+	for accept, want := range map[string]int{"": websocket.TextMessage, "application/msgpack": websocket.BinaryMessage} {
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/count", http.Header{"Accept": {accept}})
+		require.NoError(t, err)
+		messageType, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, want, messageType, accept)
+		assert.True(t, utf8.Valid(msg))
+		ws.Close()
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	s, err := NewServer(IgnoreEnv(), WithHandlerTimeout(time.Minute))
+	require.NoError(t, err)
+	deadlines := make(chan bool, 1)
+	hasDeadline := func(ctx context.Context) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+	}
+	require.NoError(t, s.Handle("GET", "/unary", func(ctx context.Context, req *emptyRequest, rsp *emptyResponse) error {
+		hasDeadline(ctx)
+		return nil
+	}, "unary", "test"))
+	stream := func(ctx context.Context, req gows.RecvStream, rsp gows.SendStream) error {
+		hasDeadline(ctx)
+		return nil
+	}
+	require.NoError(t, s.Handle("STREAM", "/stream", stream, "stream", "test"))
+	require.NoError(t, s.Handle("STREAM", "/bounded", stream, "bounded", "test", WithTimeout(time.Minute)))
+	addr := newTCPServer(t, s)
+
+	serveRequest(s, "GET", "/unary", "")
+	assert.True(t, <-deadlines)
+	for path, want := range map[string]bool{"/stream": false, "/bounded": true} {
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+path, nil)
+		require.NoError(t, err)
+		assert.Equal(t, want, <-deadlines, path)
+		ws.Close()
+	}
+}
+
+type userRequest struct {
+	ID string `json:"id" path:"userId"`
+}
+
+func TestPathTags(t *testing.T) {
+	s, err := NewServer(IgnoreEnv())
+	require.NoError(t, err)
+	handler := func(ctx context.Context, req *userRequest, rsp *emptyResponse) error {
+		return nil
+	}
+	assert.EqualError(t, s.Handle("GET", "/u/{id}", handler, "user", "test"), "path parameter userId of the request is not in /u/{id}")
+	assert.NoError(t, s.Handle("GET", "/u/{userId}", handler, "user", "test"))
+	assert.NoError(t, s.Handle("GET", "/files/*userId", handler, "files", "test"))
+}
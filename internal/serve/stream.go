@@ -1,7 +1,12 @@
 package serve
 
 import (
+	"context"
+	"time"
+
 	"github.com/fasthttp/websocket"
+	"github.com/ottstack/gofunc/pkg/ecode"
+	"github.com/ottstack/gofunc/pkg/middleware"
 )
 
 var upgrader = websocket.FastHTTPUpgrader{
@@ -12,15 +17,73 @@ var upgrader = websocket.FastHTTPUpgrader{
 type streamImp struct {
 	conn   *websocket.Conn
 	closed bool
+	cancel context.CancelFunc
+	// codec of typed messages, binary unless its media type is text
+	codec  Codec
+	binary bool
 }
 
 func (s *streamImp) Recv() ([]byte, error) {
 	_, bs, err := s.conn.ReadMessage()
+	s.checkErr(err)
 	return bs, err
 }
 
 func (s *streamImp) Send(msg []byte) error {
-	return s.conn.WriteMessage(websocket.TextMessage, msg)
+	err := s.conn.WriteMessage(websocket.TextMessage, msg)
+	s.checkErr(err)
+	return err
+}
+
+// checkErr notifies the handler through its context once the client is gone
+func (s *streamImp) checkErr(err error) {
+	if err != nil && s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// sendMessage sends an encoded message in a frame of the type of the codec
+func (s *streamImp) sendMessage(bs []byte) error {
+	messageType := websocket.TextMessage
+	if s.binary {
+		messageType = websocket.BinaryMessage
+	}
+	err := s.conn.WriteMessage(messageType, bs)
+	s.checkErr(err)
+	return err
+}
+
+// recvOf decodes and validates the messages of a stream
+type recvOf[T any] struct {
+	stream *streamImp
+}
+
+func (r recvOf[T]) Recv() (*T, error) {
+	bs, err := r.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	msg := new(T)
+	if err := r.stream.codec.Decode(bs, msg); err != nil {
+		return nil, &ecode.APIError{Code: 400, Message: "Decode message failed: " + err.Error()}
+	}
+	if err := middleware.Validate(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// sendOf encodes the messages of a stream
+type sendOf[T any] struct {
+	stream *streamImp
+}
+
+func (s sendOf[T]) Send(msg *T) error {
+	bs, err := s.stream.codec.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return s.stream.sendMessage(bs)
 }
 
 func (s *streamImp) close() {
@@ -37,3 +100,13 @@ func (s *streamImp) sendErrorMessage(err error) {
 	s.closed = true
 	s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseMessage, err.Error()))
 }
+
+// goAway asks the client to close the stream once the server starts shutting down
+func (s *streamImp) goAway(serverCtx context.Context, done <-chan struct{}) {
+	select {
+	case <-serverCtx.Done():
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	case <-done:
+	}
+}
@@ -0,0 +1,177 @@
+package serve
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ottstack/gofunc/pkg/reqctx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+}
+
+// newTestCert creates a certificate for localhost signed by parent, self-signed without parent
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}}
+}
+
+// write saves the certificate and key as pem files in dir
+func (c *testCert) write(t *testing.T, dir string) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+type subjectResponse struct {
+	Subject string `json:"subject"`
+}
+
+// newTLSServer serves a route answering the client subject over TLS on an in-memory listener
+func newTLSServer(t *testing.T, ca *testCert, optional bool) *fasthttputil.InmemoryListener {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, "server", ca).write(t, dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+
+	s, err := NewServer(IgnoreEnv(), WithTLS(certFile, keyFile), WithClientCA(caFile, optional))
+	require.NoError(t, err)
+	require.NoError(t, s.Handle("GET", "/whoami", func(ctx context.Context, req *emptyRequest, rsp *subjectResponse) error {
+		rsp.Subject = reqctx.ClientSubject(ctx)
+		return nil
+	}, "whoami", "test"))
+	ln := fasthttputil.NewInmemoryListener()
+	go s.ServeListener(ln)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return ln
+}
+
+// whoami calls the route of newTLSServer with the client certificate if not nil
+func whoami(ln *fasthttputil.InmemoryListener, ca, client *testCert) (string, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tlsConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if client != nil {
+		// sent even if the server does not trust its issuer
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &client.pair, nil
+		}
+	}
+	c := &fasthttp.Client{
+		TLSConfig: tlsConfig,
+		Dial:      func(addr string) (net.Conn, error) { return ln.Dial() },
+	}
+	code, body, err := c.Get(nil, "https://localhost/whoami")
+	if err != nil {
+		return "", err
+	}
+	if code != 200 {
+		return "", fmt.Errorf("status %d: %s", code, body)
+	}
+	return string(body), nil
+}
+
+func TestTLSClientCert(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	client := newTestCert(t, "alice", ca)
+	stranger := newTestCert(t, "mallory", newTestCert(t, "other ca", nil))
+
+	ln := newTLSServer(t, ca, false)
+	body, err := whoami(ln, ca, client)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"subject":"CN=alice"}`, body)
+	_, err = whoami(ln, ca, nil)
+	assert.Error(t, err)
+	_, err = whoami(ln, ca, stranger)
+	assert.Error(t, err)
+
+	ln = newTLSServer(t, ca, true)
+	body, err = whoami(ln, ca, nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"subject":""}`, body)
+	body, err = whoami(ln, ca, client)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"subject":"CN=alice"}`, body)
+	_, err = whoami(ln, ca, stranger)
+	assert.Error(t, err)
+}
+
+func TestCertReload(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	dir := t.TempDir()
+	first := newTestCert(t, "first", ca)
+	certFile, keyFile := first.write(t, dir)
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	second := newTestCert(t, "second", ca)
+	second.write(t, dir)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+
+	// changes are only checked once per certCheckInterval
+	cert, err := r.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.Raw, cert.Certificate[0])
+
+	r.checkedAt = time.Time{}
+	cert, err = r.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+
+	// a broken file keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	evenLater := later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(keyFile, evenLater, evenLater))
+	r.checkedAt = time.Time{}
+	cert, err = r.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.cert.Raw, cert.Certificate[0])
+}
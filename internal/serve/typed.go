@@ -0,0 +1,67 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/fasthttp/websocket"
+	"github.com/ottstack/gofunc/pkg/middleware"
+	gows "github.com/ottstack/gofunc/pkg/websocket"
+)
+
+// Typed is a handler whose request and response types are known at compile time.
+// It is called directly instead of through reflect.Value.Call.
+type Typed struct {
+	Call    middleware.MethodFunc
+	New     func() (interface{}, interface{})
+	ReqType reflect.Type
+	RspType reflect.Type
+
+	// stream of ReqType messages received and RspType messages sent
+	stream bool
+}
+
+// NewTypedStream adapts a websocket handler of In and Out messages
+func NewTypedStream[In, Out any](fn func(context.Context, gows.RecvOf[In], gows.SendOf[Out]) error) *Typed {
+	return &Typed{
+		Call: func(ctx context.Context, req, rsp interface{}) error {
+			stream := req.(*streamImp)
+			err := fn(ctx, recvOf[In]{stream: stream}, sendOf[Out]{stream: stream})
+			// ingore close error message
+			if _, ok := err.(*websocket.CloseError); ok {
+				return nil
+			}
+			return err
+		},
+		New: func() (interface{}, interface{}) {
+			stream := &streamImp{}
+			return stream, stream
+		},
+		ReqType: reflect.TypeOf((*In)(nil)).Elem(),
+		RspType: reflect.TypeOf((*Out)(nil)).Elem(),
+		stream:  true,
+	}
+}
+
+func parseTyped(m *methodInfo, t *Typed) error {
+	if t.stream != (m.httpMethod == "STREAM") {
+		return fmt.Errorf("typed handler in %s cannot be used as %s", m.path, m.httpMethod)
+	}
+	if t.ReqType.Kind() != reflect.Struct {
+		return fmt.Errorf("the type of request in %s should be struct", m.path)
+	}
+	if t.RspType.Kind() != reflect.Struct {
+		return fmt.Errorf("the type of response in %s should be struct", m.path)
+	}
+	m.call = t.Call
+	m.factory = t.New
+	m.reqType = t.ReqType
+	m.rspType = t.RspType
+	if t.stream {
+		m.isWebsocket = true
+	} else {
+		m.bindings = newRequestBindings(m.reqType)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package serve
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+const mediaTypeMultipart = "multipart/form-data"
+
+// uploadMemory is the size of file parts of compressed uploads kept in memory, larger ones are
+// spilled to temporary files. fasthttp parses uncompressed uploads itself while reading them.
+const uploadMemory = 4 << 20
+
+// File is an uploaded file part of a multipart/form-data request,
+// request fields of type *File or []*File are bound by their json name
+type File struct {
+	Name        string // file name sent by the client
+	Size        int64
+	ContentType string
+
+	header *multipart.FileHeader
+}
+
+// Open returns the content of the file, the caller closes it.
+// Files are removed once the handler returns.
+func (f *File) Open() (multipart.File, error) {
+	if f.header == nil {
+		return nil, errors.New("file content is not uploaded")
+	}
+	return f.header.Open()
+}
+
+var (
+	fileType      = reflect.TypeOf(File{})
+	filePtrType   = reflect.PtrTo(fileType)
+	fileSliceType = reflect.SliceOf(filePtrType)
+)
+
+// fileFields collects the exported fields of struct type t holding uploaded files
+func fileFields(t reflect.Type) boundFields {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var ret boundFields
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, sub := range fileFields(field.Type) {
+				sub.index = append([]int{i}, sub.index...)
+				ret = append(ret, sub)
+			}
+			continue
+		}
+		if !unicode.IsUpper(rune(field.Name[0])) || (field.Type != filePtrType && field.Type != fileSliceType) {
+			continue
+		}
+		name := field.Tag.Get(filedNameTag)
+		if idx := strings.IndexRune(name, ','); idx >= 0 {
+			name = name[:idx]
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		validateTag := field.Tag.Get("validate")
+		ret = append(ret, boundField{
+			name:     name,
+			index:    field.Index,
+			typ:      field.Type,
+			required: strings.HasSuffix(validateTag, "required") || strings.Contains(validateTag, "required,"),
+			comment:  field.Tag.Get("comment"),
+		})
+	}
+	return ret
+}
+
+func isMultipart(contentType []byte) bool {
+	mediaType, _ := parseMediaRange(string(contentType))
+	return mediaType == mediaTypeMultipart
+}
+
+// readMultipart parses a decompressed multipart/form-data body, the caller removes the form
+func readMultipart(body, contentType []byte) (*multipart.Form, error) {
+	_, params, err := mime.ParseMediaType(string(contentType))
+	if err != nil {
+		return nil, err
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, errors.New("missing multipart boundary")
+	}
+	return multipart.NewReader(bytes.NewReader(body), boundary).ReadForm(uploadMemory)
+}
+
+// bindMultipart decodes the values of form into v and binds its files into files
+func bindMultipart(form *multipart.Form, files boundFields, v interface{}) error {
+	if err := valuesDecoder(form.Value, v); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v).Elem()
+	for _, f := range files {
+		headers := form.File[f.name]
+		if len(headers) == 0 {
+			continue
+		}
+		fv := fieldByIndex(rv, f.index)
+		if f.typ == fileSliceType {
+			slice := make([]*File, len(headers))
+			for i, h := range headers {
+				slice[i] = newFile(h)
+			}
+			fv.Set(reflect.ValueOf(slice))
+		} else {
+			fv.Set(reflect.ValueOf(newFile(headers[0])))
+		}
+	}
+	return nil
+}
+
+func newFile(h *multipart.FileHeader) *File {
+	return &File{Name: h.Filename, Size: h.Size, ContentType: h.Header.Get("Content-Type"), header: h}
+}
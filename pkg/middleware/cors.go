@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// CORSConfig configures the CORS middleware
+type CORSConfig struct {
+	// AllowOrigins lists allowed origins, an entry may be "*" or contain one wildcard like "https://*.example.com"
+	AllowOrigins []string
+	// AllowMethods defaults to GET, HEAD, POST, PUT, PATCH, DELETE and OPTIONS
+	AllowMethods []string
+	// AllowHeaders defaults to the headers asked by the preflight request
+	AllowHeaders []string
+	// ExposeHeaders lists response headers readable by the browser
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and authorization headers, it cannot be combined with the "*" origin
+	AllowCredentials bool
+	// MaxAge is how long the preflight result can be cached
+	MaxAge time.Duration
+}
+
+// CORS returns a middleware answering preflight requests and setting CORS headers.
+// Register it with UseHTTP so that it also covers raw handlers and error responses.
+// It panics if AllowOrigins contains "*" and AllowCredentials is set.
+func CORS(cfg CORSConfig) Middleware {
+	allowMethods := "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+	if len(cfg.AllowMethods) > 0 {
+		allowMethods = strings.ToUpper(strings.Join(cfg.AllowMethods, ", "))
+	}
+	allowHeaders := strings.Join(cfg.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := ""
+	if cfg.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+	allowAll := false
+	for _, o := range cfg.AllowOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+	}
+	if allowAll && cfg.AllowCredentials {
+		panic("middleware: CORS AllowOrigins \"*\" cannot be used with AllowCredentials, list the origins instead")
+	}
+
+	return func(ctx context.Context, fastReq *fasthttp.RequestCtx, method MethodFunc, req, rsp interface{}) error {
+		origin := string(fastReq.Request.Header.Peek("Origin"))
+		if origin == "" {
+			return method(ctx, req, rsp)
+		}
+		header := &fastReq.Response.Header
+		header.Add("Vary", "Origin")
+		preflight := fastReq.IsOptions() && len(fastReq.Request.Header.Peek("Access-Control-Request-Method")) > 0
+		if !allowAll && !matchOrigin(cfg.AllowOrigins, origin) {
+			if preflight {
+				fastReq.SetStatusCode(fasthttp.StatusNoContent)
+				return nil
+			}
+			return method(ctx, req, rsp)
+		}
+
+		if allowAll {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			return method(ctx, req, rsp)
+		}
+
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if reqHeaders := fastReq.Request.Header.Peek("Access-Control-Request-Headers"); len(reqHeaders) > 0 {
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.SetBytesV("Access-Control-Allow-Headers", reqHeaders)
+		}
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		fastReq.SetStatusCode(fasthttp.StatusNoContent)
+		return nil
+	}
+}
+
+func matchOrigin(patterns []string, origin string) bool {
+	for _, p := range patterns {
+		if idx := strings.IndexByte(p, '*'); idx >= 0 {
+			prefix, suffix := p[:idx], p[idx+1:]
+			if len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		} else if strings.EqualFold(p, origin) {
+			return true
+		}
+	}
+	return false
+}
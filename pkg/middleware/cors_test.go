@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	cors := CORS(CORSConfig{
+		AllowOrigins:     []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute,
+	})
+	called := false
+	next := func(ctx context.Context, req, rsp interface{}) error {
+		called = true
+		return nil
+	}
+
+	fastReq := &fasthttp.RequestCtx{}
+	fastReq.Request.Header.SetMethod("OPTIONS")
+	fastReq.Request.Header.Set("Origin", "https://app.example.com")
+	fastReq.Request.Header.Set("Access-Control-Request-Method", "PUT")
+	fastReq.Request.Header.Set("Access-Control-Request-Headers", "x-token")
+	assert.Nil(t, cors(context.Background(), fastReq, next, nil, nil))
+	assert.False(t, called)
+	assert.Equal(t, 204, fastReq.Response.StatusCode())
+	assert.Equal(t, "https://app.example.com", string(fastReq.Response.Header.Peek("Access-Control-Allow-Origin")))
+	assert.Equal(t, "true", string(fastReq.Response.Header.Peek("Access-Control-Allow-Credentials")))
+	assert.Equal(t, "x-token", string(fastReq.Response.Header.Peek("Access-Control-Allow-Headers")))
+	assert.Equal(t, "60", string(fastReq.Response.Header.Peek("Access-Control-Max-Age")))
+
+	fastReq = &fasthttp.RequestCtx{}
+	fastReq.Request.Header.SetMethod("GET")
+	fastReq.Request.Header.Set("Origin", "https://evil.com")
+	assert.Nil(t, cors(context.Background(), fastReq, next, nil, nil))
+	assert.True(t, called)
+	assert.Equal(t, "", string(fastReq.Response.Header.Peek("Access-Control-Allow-Origin")))
+}
+
+func TestCORSWildcardCredentials(t *testing.T) {
+	assert.Panics(t, func() {
+		CORS(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+	})
+
+	cors := CORS(CORSConfig{AllowOrigins: []string{"*"}})
+	fastReq := &fasthttp.RequestCtx{}
+	fastReq.Request.Header.SetMethod("GET")
+	fastReq.Request.Header.Set("Origin", "https://any.com")
+	next := func(ctx context.Context, req, rsp interface{}) error { return nil }
+	assert.Nil(t, cors(context.Background(), fastReq, next, nil, nil))
+	assert.Equal(t, "*", string(fastReq.Response.Header.Peek("Access-Control-Allow-Origin")))
+	assert.Equal(t, "", string(fastReq.Response.Header.Peek("Access-Control-Allow-Credentials")))
+}
@@ -7,4 +7,6 @@ import (
 )
 
 type MethodFunc func(context.Context, interface{}, interface{}) error
+
+// Middleware wraps typed handlers, or every request with nil req and rsp when added with UseHTTP
 type Middleware func(ctx context.Context, fastReq *fasthttp.RequestCtx, method MethodFunc, req, rsp interface{}) error
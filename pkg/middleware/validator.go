@@ -3,16 +3,27 @@ package middleware
 import (
 	"context"
 
-	"github.com/ottstack/gofunc/pkg/ecode"
 	validate "github.com/go-playground/validator/v10"
+	"github.com/ottstack/gofunc/pkg/ecode"
 	"github.com/valyala/fasthttp"
 )
 
 var validator = validate.New()
 
 func Validator(ctx context.Context, fastReq *fasthttp.RequestCtx, method MethodFunc, req, rsp interface{}) (err error) {
-	if err := validator.Struct(req); err != nil {
-		return &ecode.APIError{Code: 400, Message: err.Error()}
+	if req == nil {
+		return method(ctx, req, rsp)
+	}
+	if err := Validate(req); err != nil {
+		return err
 	}
 	return method(ctx, req, rsp)
 }
+
+// Validate checks the validate tags of struct v, failures are returned as a 400 APIError
+func Validate(v interface{}) error {
+	if err := validator.Struct(v); err != nil {
+		return &ecode.APIError{Code: 400, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package reqctx gives handlers access to the http request behind their context.
+package reqctx
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+
+	"github.com/valyala/fasthttp"
+)
+
+type requestKey struct{}
+
+// NewContext returns a copy of parent carrying fastReq
+func NewContext(parent context.Context, fastReq *fasthttp.RequestCtx) context.Context {
+	return context.WithValue(parent, requestKey{}, fastReq)
+}
+
+// RequestCtx returns the underlying fasthttp request, or nil if ctx does not carry one
+func RequestCtx(ctx context.Context) *fasthttp.RequestCtx {
+	fastReq, _ := ctx.Value(requestKey{}).(*fasthttp.RequestCtx)
+	return fastReq
+}
+
+// Header returns the value of request header key
+func Header(ctx context.Context, key string) string {
+	fastReq := RequestCtx(ctx)
+	if fastReq == nil {
+		return ""
+	}
+	return string(fastReq.Request.Header.Peek(key))
+}
+
+// RemoteAddr returns the address of the client
+func RemoteAddr(ctx context.Context) net.Addr {
+	fastReq := RequestCtx(ctx)
+	if fastReq == nil {
+		return nil
+	}
+	return fastReq.RemoteAddr()
+}
+
+// PathParam returns the value of path parameter name matched by the route
+func PathParam(ctx context.Context, name string) string {
+	fastReq := RequestCtx(ctx)
+	if fastReq == nil {
+		return ""
+	}
+	v, _ := fastReq.UserValue(name).(string)
+	return v
+}
+
+// SetStatus sets the status code of a successful response, e.g. 201, 202 or 204.
+// It has no effect if the handler returns an error.
+func SetStatus(ctx context.Context, code int) {
+	if fastReq := RequestCtx(ctx); fastReq != nil {
+		fastReq.Response.SetStatusCode(code)
+	}
+}
+
+// SetHeader sets a response header
+func SetHeader(ctx context.Context, key, value string) {
+	if fastReq := RequestCtx(ctx); fastReq != nil {
+		fastReq.Response.Header.Set(key, value)
+	}
+}
+
+// AddHeader appends a response header, keeping existing values of key
+func AddHeader(ctx context.Context, key, value string) {
+	if fastReq := RequestCtx(ctx); fastReq != nil {
+		fastReq.Response.Header.Add(key, value)
+	}
+}
+
+// SetCookie adds a Set-Cookie header to the response
+func SetCookie(ctx context.Context, cookie *fasthttp.Cookie) {
+	if fastReq := RequestCtx(ctx); fastReq != nil {
+		fastReq.Response.Header.SetCookie(cookie)
+	}
+}
+
+// Redirect replies with a redirect to uri, the response body is omitted.
+// statusCode should be one of 301, 302, 303, 307 or 308.
+func Redirect(ctx context.Context, uri string, statusCode int) {
+	if fastReq := RequestCtx(ctx); fastReq != nil {
+		fastReq.Redirect(uri, statusCode)
+	}
+}
+
+// ClientCert returns the verified client certificate of a mutual TLS connection, or nil
+func ClientCert(ctx context.Context) *x509.Certificate {
+	fastReq := RequestCtx(ctx)
+	if fastReq == nil {
+		return nil
+	}
+	state := fastReq.TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// ClientSubject returns the subject of the verified client certificate, or "" without one
+func ClientSubject(ctx context.Context) string {
+	cert := ClientCert(ctx)
+	if cert == nil {
+		return ""
+	}
+	return cert.Subject.String()
+}
@@ -0,0 +1,69 @@
+package reqctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func newContext() (context.Context, *fasthttp.RequestCtx) {
+	fastReq := &fasthttp.RequestCtx{}
+	fastReq.Request.SetRequestURI("http://localhost/users")
+	fastReq.Request.Header.Set("X-Tenant", "acme")
+	fastReq.SetUserValue("id", "42")
+	return NewContext(context.Background(), fastReq), fastReq
+}
+
+func TestAccessors(t *testing.T) {
+	ctx, fastReq := newContext()
+	assert.Equal(t, fastReq, RequestCtx(ctx))
+	assert.Equal(t, "acme", Header(ctx, "X-Tenant"))
+	assert.Equal(t, "42", PathParam(ctx, "id"))
+	assert.Nil(t, ClientCert(ctx))
+	assert.Equal(t, "", ClientSubject(ctx))
+
+	// a context without request is a no-op
+	empty := context.Background()
+	assert.Nil(t, RequestCtx(empty))
+	assert.Equal(t, "", Header(empty, "X-Tenant"))
+	assert.Nil(t, RemoteAddr(empty))
+	SetStatus(empty, 201)
+	SetHeader(empty, "X-Request-Id", "1")
+}
+
+func TestSetters(t *testing.T) {
+	ctx, fastReq := newContext()
+	SetStatus(ctx, 201)
+	SetHeader(ctx, "X-Request-Id", "1")
+	SetHeader(ctx, "X-Request-Id", "2")
+	AddHeader(ctx, "Link", "</a>")
+	AddHeader(ctx, "Link", "</b>")
+	cookie := &fasthttp.Cookie{}
+	cookie.SetKey("session")
+	cookie.SetValue("s1")
+	SetCookie(ctx, cookie)
+
+	rsp := &fastReq.Response
+	assert.Equal(t, 201, rsp.StatusCode())
+	assert.Equal(t, "2", string(rsp.Header.Peek("X-Request-Id")))
+	var links []string
+	rsp.Header.VisitAll(func(key, value []byte) {
+		if string(key) == "Link" {
+			links = append(links, string(value))
+		}
+	})
+	assert.Equal(t, []string{"</a>", "</b>"}, links)
+	got := &fasthttp.Cookie{}
+	got.SetKey("session")
+	assert.True(t, rsp.Header.Cookie(got))
+	assert.Equal(t, "s1", string(got.Value()))
+}
+
+func TestRedirect(t *testing.T) {
+	ctx, fastReq := newContext()
+	Redirect(ctx, "/login", 303)
+	assert.Equal(t, 303, fastReq.Response.StatusCode())
+	assert.Equal(t, "http://localhost/login", string(fastReq.Response.Header.Peek("Location")))
+}
@@ -0,0 +1,21 @@
+package sse
+
+import "time"
+
+// Event is a server-sent event, empty fields are not sent
+type Event struct {
+	// ID is sent back by a reconnecting client as Last-Event-ID
+	ID    string
+	Event string
+	Data  []byte
+	// Retry asks the client to wait so long before reconnecting
+	Retry time.Duration
+}
+
+type SendStream interface {
+	// Send sends data as an unnamed event
+	Send([]byte) error
+	SendEvent(Event) error
+	// LastEventID returns the Last-Event-ID header of a reconnecting client to resume from
+	LastEventID() string
+}
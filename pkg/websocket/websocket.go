@@ -7,3 +7,14 @@ type RecvStream interface {
 type SendStream interface {
 	Send([]byte) error
 }
+
+// RecvOf receives messages decoded by the codec selected from the Accept header of the
+// handshake, JSON by default. Invalid messages are returned as a 400 *ecode.APIError.
+type RecvOf[T any] interface {
+	Recv() (*T, error)
+}
+
+// SendOf sends messages encoded by the codec of the stream
+type SendOf[T any] interface {
+	Send(*T) error
+}
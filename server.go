@@ -0,0 +1,208 @@
+package gofunc
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/ottstack/gofunc/internal/serve"
+	"github.com/ottstack/gofunc/pkg/middleware"
+	"github.com/valyala/fasthttp"
+)
+
+// ServerOption configures a Server. Environment variables take precedence over options,
+// they are named SERVE_ and the config field, e.g. SERVE_ADDR, unless WithEnvPrefix is set.
+type ServerOption = serve.Option
+
+// Trailing slash modes of WithTrailingSlash
+const (
+	TrailingSlashStrict   = serve.TrailingSlashStrict
+	TrailingSlashRedirect = serve.TrailingSlashRedirect
+	TrailingSlashTolerate = serve.TrailingSlashTolerate
+)
+
+// IgnoreEnv configures the server from options only, skipping environment variables
+func IgnoreEnv() ServerOption {
+	return serve.IgnoreEnv()
+}
+
+// WithEnvPrefix reads environment variables named prefix_FIELD instead of SERVE_FIELD,
+// e.g. WithEnvPrefix("ADMIN") reads ADMIN_ADDR, so that several servers can be configured apart
+func WithEnvPrefix(prefix string) ServerOption {
+	return serve.WithEnvPrefix(prefix)
+}
+
+// WithAddr sets the listen address, "host:port" or "unix:/path/to.sock", overridden by SERVE_ADDR
+func WithAddr(addr string) ServerOption {
+	return serve.WithAddr(addr)
+}
+
+// WithSwaggerPath sets the path of API document pages, overridden by SERVE_SWAGGERPATH
+func WithSwaggerPath(path string) ServerOption {
+	return serve.WithSwaggerPath(path)
+}
+
+// WithHandlerTimeout sets the default deadline of handler contexts, overridden by SERVE_TIMEOUT.
+// Websocket and event streams only get a deadline through the Timeout route option.
+func WithHandlerTimeout(d time.Duration) ServerOption {
+	return serve.WithHandlerTimeout(d)
+}
+
+// WithDrainTimeout sets how long shutdown waits for in-flight requests, overridden by SERVE_DRAINTIMEOUT
+func WithDrainTimeout(d time.Duration) ServerOption {
+	return serve.WithDrainTimeout(d)
+}
+
+// WithTrailingSlash sets the trailing slash mode, overridden by SERVE_TRAILINGSLASH
+func WithTrailingSlash(mode string) ServerOption {
+	return serve.WithTrailingSlash(mode)
+}
+
+// WithCaseInsensitive matches static path segments ignoring case, overridden by SERVE_CASEINSENSITIVE
+func WithCaseInsensitive(enabled bool) ServerOption {
+	return serve.WithCaseInsensitive(enabled)
+}
+
+// WithReadTimeout sets fasthttp.Server.ReadTimeout, overridden by SERVE_READTIMEOUT
+func WithReadTimeout(d time.Duration) ServerOption {
+	return serve.WithReadTimeout(d)
+}
+
+// WithWriteTimeout sets fasthttp.Server.WriteTimeout, overridden by SERVE_WRITETIMEOUT
+func WithWriteTimeout(d time.Duration) ServerOption {
+	return serve.WithWriteTimeout(d)
+}
+
+// WithIdleTimeout sets fasthttp.Server.IdleTimeout, overridden by SERVE_IDLETIMEOUT
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return serve.WithIdleTimeout(d)
+}
+
+// WithMaxRequestBodySize sets fasthttp.Server.MaxRequestBodySize, overridden by SERVE_MAXREQUESTBODYSIZE
+func WithMaxRequestBodySize(size int) ServerOption {
+	return serve.WithMaxRequestBodySize(size)
+}
+
+// WithConcurrency sets fasthttp.Server.Concurrency, overridden by SERVE_CONCURRENCY
+func WithConcurrency(n int) ServerOption {
+	return serve.WithConcurrency(n)
+}
+
+// WithKeepAlive enables or disables keep-alive connections, overridden by SERVE_DISABLEKEEPALIVE
+func WithKeepAlive(enabled bool) ServerOption {
+	return serve.WithKeepAlive(enabled)
+}
+
+// WithName sets the Server response header, overridden by SERVE_NAME
+func WithName(name string) ServerOption {
+	return serve.WithName(name)
+}
+
+// WithTLS serves https with the certificate and key files, reloaded when they change on disk.
+// Overridden by SERVE_CERTFILE and SERVE_KEYFILE.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return serve.WithTLS(certFile, keyFile)
+}
+
+// WithClientCA verifies client certificates against the CA file, optional accepts clients without one.
+// The verified certificate is available to handlers through reqctx.ClientCert.
+// Overridden by SERVE_CLIENTCAFILE and SERVE_CLIENTCERTOPTIONAL.
+func WithClientCA(caFile string, optional bool) ServerOption {
+	return serve.WithClientCA(caFile, optional)
+}
+
+// WithReusePort opens one SO_REUSEPORT listener per GOMAXPROCS, overridden by SERVE_REUSEPORT
+func WithReusePort(enabled bool) ServerOption {
+	return serve.WithReusePort(enabled)
+}
+
+// WithCompression compresses responses of at least minSize bytes with br, zstd or gzip
+// as accepted by the client. Overridden by SERVE_COMPRESS and SERVE_COMPRESSMINSIZE.
+func WithCompression(minSize int) ServerOption {
+	return serve.WithCompression(minSize)
+}
+
+// Server is an independent API with its own routes, middlewares and document,
+// several of them can be served in one process on different addresses
+type Server struct {
+	server *serve.Server
+	err    error
+}
+
+// NewServer creates a server configured by opts, environment variables take precedence
+func NewServer(opts ...ServerOption) (*Server, error) {
+	server, err := serve.NewServer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{server: server}, nil
+}
+
+// ApiGroup creates a group of routes tagged name in the API document.
+// The optional prefix is prepended to every route path of the group.
+func (s *Server) ApiGroup(name string, prefix ...string) *Router {
+	return &Router{server: s, name: name, prefix: joinPath("", prefix...)}
+}
+
+// Use adds a middleware wrapping every typed handler of s
+func (s *Server) Use(m middleware.Middleware) *Server {
+	s.server.Use(m)
+	return s
+}
+
+// UseHTTP adds a middleware wrapping every request of s before routing, with nil req and rsp.
+// It also covers raw http handlers, preflight requests and errors answered before a handler runs
+// such as 404, 405 or 415, e.g. middleware.CORS.
+func (s *Server) UseHTTP(m middleware.Middleware) *Server {
+	s.server.UseHTTP(m)
+	return s
+}
+
+// HandleHTTP registers a raw fasthttp handler, it is not documented
+func (s *Server) HandleHTTP(method, path string, f func(*fasthttp.RequestCtx)) {
+	err := s.server.Handle(method, path, f, "", "")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// PathMapping maps external paths onto registered routes, e.g. "/hello" -> "/api/hello".
+// A "/*" suffix on both sides rewrites a prefix, e.g. "/v1/*" -> "/api/*".
+func (s *Server) PathMapping(m map[string]string) *Server {
+	s.server.PathMapping(m)
+	return s
+}
+
+// Codec decodes request bodies and encodes response bodies of one media type
+type Codec = serve.Codec
+
+// RegisterCodec adds or replaces the codec of mediaType, selected by the Content-Type and Accept headers.
+// Built-in codecs are application/json (the default), application/x-www-form-urlencoded,
+// application/xml and application/msgpack. Ties between accepted types go to the earliest registered one.
+// Typed stream messages go in text frames for text, json, xml and form media types, binary ones otherwise.
+func (s *Server) RegisterCodec(mediaType string, c Codec) *Server {
+	s.server.RegisterCodec(mediaType, c)
+	return s
+}
+
+// Serve serves until SIGTERM/SIGINT or Shutdown, draining in-flight requests before returning
+func (s *Server) Serve() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.server.Serve()
+}
+
+// ServeListener serves on ln instead of the configured address, wrapped with TLS if configured.
+// It does not handle signals, the caller stops it with Shutdown.
+func (s *Server) ServeListener(ln net.Listener) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.server.ServeListener(ln)
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight requests and streams until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}